@@ -24,6 +24,9 @@ type Client struct {
 	url    string
 	client *http.Client
 
+	externalLabels       []*prompb.Label // sorted by name
+	externalLabelsPolicy ExternalLabelsPolicy
+
 	RequestCounter         *prometheus.CounterVec
 	RequestBytesCounter    *prometheus.CounterVec
 	WriteTimeSeriesCounter *prometheus.CounterVec
@@ -62,10 +65,15 @@ func NewClient(url string, opts ...Option) *Client {
 	f.WithLabelValues("dialTimeout", c.DialTimeout.String()).Set(1)
 	f.WithLabelValues("timeout", c.Timeout.String()).Set(1)
 	f.WithLabelValues("url", url).Set(1)
+	if len(c.ExternalLabels) > 0 {
+		f.WithLabelValues("externalLabelsPolicy", c.ExternalLabelsPolicy.String()).Set(1)
+	}
 
 	return &Client{
-		url:    url,
-		client: httpclient,
+		url:                  url,
+		client:               httpclient,
+		externalLabels:       externalLabels(c.ExternalLabels),
+		externalLabelsPolicy: c.ExternalLabelsPolicy,
 		RequestCounter: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "remotewrite_client_request_total",
@@ -95,12 +103,20 @@ func (c *Client) Name() string {
 }
 
 func (c *Client) Write(series []*prompb.TimeSeries) error {
-	if len(series) == 0 {
+	return c.WriteWithMetadata(series, nil)
+}
+
+// WriteWithMetadata sends the series together with their metric metadata, e.g. the result of metric.GatherTimeSeries
+// The external labels are merged into every series, see WithExternalLabels
+func (c *Client) WriteWithMetadata(series []*prompb.TimeSeries, metadata []*prompb.MetricMetadata) error {
+	if len(series) == 0 && len(metadata) == 0 {
 		return nil
 	}
+	series = withExternalLabels(series, c.externalLabels, c.externalLabelsPolicy)
 
 	req := &prompb.WriteRequest{
 		Timeseries: series,
+		Metadata:   metadata,
 	}
 
 	bys, err := proto.Marshal(req)
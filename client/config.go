@@ -1,10 +1,16 @@
 package client
 
-import "time"
+import (
+	"maps"
+	"time"
+)
 
 type config struct {
 	DialTimeout time.Duration
 	Timeout     time.Duration
+
+	ExternalLabels       map[string]string
+	ExternalLabelsPolicy ExternalLabelsPolicy
 }
 
 func newConfig(opts ...Option) *config {
@@ -27,6 +33,7 @@ type optionFunc func(*config)
 func (f optionFunc) apply(c *config) {
 	f(c)
 }
+
 func WithDialTimeout(d time.Duration) Option {
 	return optionFunc(func(c *config) {
 		c.DialTimeout = d
@@ -38,3 +45,20 @@ func WithTimeout(d time.Duration) Option {
 		c.Timeout = d
 	})
 }
+
+// WithExternalLabels adds the labels to every TimeSeries before sending, like external_labels of Prometheus,
+// e.g. cluster, replica and env. Labels with empty value are ignored.
+// A label which also exists in the series is resolved by WithExternalLabelsPolicy.
+func WithExternalLabels(labels map[string]string) Option {
+	return optionFunc(func(c *config) {
+		c.ExternalLabels = maps.Clone(labels)
+	})
+}
+
+// WithExternalLabelsPolicy sets how to resolve a label existing in both the series and the external labels,
+// the default is SeriesLabelsWin as Prometheus does
+func WithExternalLabelsPolicy(p ExternalLabelsPolicy) Option {
+	return optionFunc(func(c *config) {
+		c.ExternalLabelsPolicy = p
+	})
+}
@@ -0,0 +1,108 @@
+package client
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"github.com/sq325/remoteWrite/prompb"
+)
+
+// ExternalLabelsPolicy resolves a label existing in both the series and the external labels
+type ExternalLabelsPolicy int
+
+const (
+	SeriesLabelsWin   ExternalLabelsPolicy = iota // keep the label value of the series
+	ExternalLabelsWin                             // overwrite the label value of the series
+)
+
+func (p ExternalLabelsPolicy) String() string {
+	switch p {
+	case SeriesLabelsWin:
+		return "series"
+	case ExternalLabelsWin:
+		return "external"
+	default:
+		return "unknown"
+	}
+}
+
+// externalLabels converts the external labels to []*prompb.Label sorted by name,
+// labels with invalid or reserved names are dropped with an error logged, labels with empty value are dropped
+func externalLabels(labels map[string]string) []*prompb.Label {
+	pbLabels := make([]*prompb.Label, 0, len(labels))
+	for name, value := range labels {
+		if !model.LabelName(name).IsValid() || strings.HasPrefix(name, model.ReservedLabelPrefix) {
+			slog.Error("invalid external label name, dropped", "name", name, "value", value)
+			continue
+		}
+		if value == "" {
+			continue
+		}
+		pbLabels = append(pbLabels, &prompb.Label{Name: name, Value: value})
+	}
+	slices.SortFunc(pbLabels, compareLabels)
+	return pbLabels
+}
+
+func compareLabels(a, b *prompb.Label) int {
+	return strings.Compare(a.Name, b.Name)
+}
+
+// sortedLabels returns labels sorted by name, labels is cloned before sorting if not sorted
+func sortedLabels(labels []*prompb.Label) []*prompb.Label {
+	if slices.IsSortedFunc(labels, compareLabels) {
+		return labels
+	}
+	labels = slices.Clone(labels)
+	slices.SortStableFunc(labels, compareLabels)
+	return labels
+}
+
+// withExternalLabels returns new TimeSeries with the external labels merged, series are not modified.
+// The merged labels are sorted by name as the remote write spec requires.
+func withExternalLabels(series []*prompb.TimeSeries, external []*prompb.Label, policy ExternalLabelsPolicy) []*prompb.TimeSeries {
+	if len(external) == 0 {
+		return series
+	}
+
+	merged := make([]*prompb.TimeSeries, 0, len(series))
+	for _, ts := range series {
+		merged = append(merged, &prompb.TimeSeries{
+			Labels:     mergeLabels(ts.Labels, external, policy),
+			Samples:    ts.Samples,
+			Exemplars:  ts.Exemplars,
+			Histograms: ts.Histograms,
+		})
+	}
+	return merged
+}
+
+// mergeLabels merges two label sets into one sorted by name,
+// the label sets are sorted first, as custom PBMetrics may generate unsorted labels
+func mergeLabels(labels, external []*prompb.Label, policy ExternalLabelsPolicy) []*prompb.Label {
+	labels, external = sortedLabels(labels), sortedLabels(external)
+	merged := make([]*prompb.Label, 0, len(labels)+len(external))
+	i, j := 0, 0
+	for i < len(labels) && j < len(external) {
+		switch c := strings.Compare(labels[i].Name, external[j].Name); {
+		case c < 0:
+			merged = append(merged, labels[i])
+			i++
+		case c > 0:
+			merged = append(merged, external[j])
+			j++
+		default:
+			if policy == ExternalLabelsWin {
+				merged = append(merged, external[j])
+			} else {
+				merged = append(merged, labels[i])
+			}
+			i++
+			j++
+		}
+	}
+	merged = append(merged, labels[i:]...)
+	return append(merged, external[j:]...)
+}
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sq325/remoteWrite/prompb"
+)
+
+func TestWithExternalLabels(t *testing.T) {
+	series := []*prompb.TimeSeries{
+		{
+			Labels: []*prompb.Label{
+				{Name: "__name__", Value: "up"},
+				{Name: "env", Value: "dev"},
+				{Name: "job", Value: "api"},
+			},
+			Samples: []*prompb.Sample{{Value: 1, Timestamp: 1}},
+		},
+	}
+	external := externalLabels(map[string]string{
+		"cluster":  "c1",
+		"env":      "prod",
+		"replica":  "",
+		"__name__": "x",
+	})
+
+	tests := []struct {
+		name   string
+		policy ExternalLabelsPolicy
+		want   map[string]string
+	}{
+		{
+			name:   "series wins",
+			policy: SeriesLabelsWin,
+			want:   map[string]string{"__name__": "up", "cluster": "c1", "env": "dev", "job": "api"},
+		},
+		{
+			name:   "external wins",
+			policy: ExternalLabelsWin,
+			want:   map[string]string{"__name__": "up", "cluster": "c1", "env": "prod", "job": "api"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := withExternalLabels(series, external, tt.policy)
+			if len(got) != 1 || got[0].Samples[0].Value != 1 {
+				t.Fatalf("withExternalLabels() = %v", got)
+			}
+			labels := map[string]string{}
+			for i, l := range got[0].Labels {
+				if i > 0 && got[0].Labels[i-1].Name >= l.Name {
+					t.Errorf("labels are not sorted: %v", got[0].Labels)
+				}
+				labels[l.Name] = l.Value
+			}
+			if !reflect.DeepEqual(labels, tt.want) {
+				t.Errorf("withExternalLabels() labels = %v, want %v", labels, tt.want)
+			}
+			if len(series[0].Labels) != 3 {
+				t.Errorf("withExternalLabels() modified the series: %v", series[0].Labels)
+			}
+		})
+	}
+}
+
+func TestMergeLabels_Unsorted(t *testing.T) {
+	labels := []*prompb.Label{
+		{Name: "job", Value: "api"},
+		{Name: "__name__", Value: "up"},
+		{Name: "env", Value: "dev"},
+	}
+	external := []*prompb.Label{
+		{Name: "env", Value: "prod"},
+		{Name: "cluster", Value: "c1"},
+	}
+
+	got := mergeLabels(labels, external, ExternalLabelsWin)
+	want := []*prompb.Label{
+		{Name: "__name__", Value: "up"},
+		{Name: "cluster", Value: "c1"},
+		{Name: "env", Value: "prod"},
+		{Name: "job", Value: "api"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("mergeLabels() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i].Name != want[i].Name || got[i].Value != want[i].Value {
+			t.Errorf("mergeLabels()[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+	if labels[0].Name != "job" {
+		t.Errorf("mergeLabels() modified labels: %v", labels)
+	}
+}
@@ -6,13 +6,14 @@ require (
 	github.com/golang/snappy v0.0.4
 	github.com/prometheus/client_golang v1.19.1
 	github.com/prometheus/client_model v0.5.0
+	github.com/prometheus/common v0.48.0
 	google.golang.org/protobuf v1.34.2
 )
 
 require (
 	github.com/beorn7/perks v1.0.1 // indirect
 	github.com/cespare/xxhash/v2 v2.2.0 // indirect
-	github.com/prometheus/common v0.48.0 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/prometheus/procfs v0.12.0 // indirect
 	golang.org/x/sys v0.17.0 // indirect
 )
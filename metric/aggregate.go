@@ -0,0 +1,179 @@
+package metric
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"github.com/sq325/remoteWrite/prompb"
+)
+
+var ErrMergeMismatch = errors.New("metrics to merge have different labels or buckets")
+
+// Aggregation is a view over a PBMetric which sums away the given labels, like `sum without(...)` of PromQL.
+// The series of the PBMetric with the same labels after removing are summed into one series,
+// e.g. the _bucket, _sum and _count series of a PBHistogram keep being a histogram.
+// Only float samples are aggregated, the last sample of each series is used,
+// staleness markers are skipped unless all series of a group are stale.
+// Only the series of counters and histograms are summed, the others are dropped as a sum is meaningless for them:
+// the _created series, and if the PBMetric is a PBDescriber, the series of gauges and summaries.
+// The view must replace the PBMetric rather than be pushed or registered next to it:
+// TimeSeries of the PBMetric drains its staleness markers, expires its series and advances its last push,
+// so pushing both loses the staleness markers and the zero samples of one of them.
+// Aggregation implements PBMetric, and PBDescriber if the PBMetric does
+type Aggregation struct {
+	m       PBMetric
+	without []string
+}
+
+var _ PBDescriber = (*Aggregation)(nil)
+
+// SumWithout panics if without contains __name__ or bucket_label, which are required by the reduced series
+// Push or register the returned Aggregation instead of m, see Aggregation.
+func SumWithout(m PBMetric, without ...string) *Aggregation {
+	for _, label := range without {
+		if label == model.MetricNameLabel || label == bucket_label {
+			panic(fmt.Errorf("%w: %q can not be aggregated away", ErrInvalidName, label))
+		}
+	}
+	return &Aggregation{
+		m:       m,
+		without: slices.Clone(without),
+	}
+}
+
+// Implement PBMetric interface
+// timestamp: timestamp is in ms format, the aggregated sample uses the latest timestamp of the group
+func (a *Aggregation) TimeSeries(timestamp int64) []*prompb.TimeSeries {
+	type group struct {
+		labels []*prompb.Label
+		sample *prompb.Sample
+		stale  bool // all samples are staleness markers
+	}
+	var (
+		groups   []*group
+		index    = map[string]*group{}
+		key      strings.Builder
+		summable = a.summableNames()
+	)
+	for _, ts := range a.m.TimeSeries(timestamp) {
+		if len(ts.Samples) == 0 || !isSummable(ts, summable) {
+			continue
+		}
+		smp := ts.Samples[len(ts.Samples)-1]
+
+		labels := make([]*prompb.Label, 0, len(ts.Labels))
+		key.Reset()
+		for _, l := range ts.Labels {
+			if slices.Contains(a.without, l.Name) {
+				continue
+			}
+			labels = append(labels, l)
+			key.WriteString(l.Name)
+			key.WriteByte(model.SeparatorByte)
+			key.WriteString(l.Value)
+			key.WriteByte(model.SeparatorByte)
+		}
+
+		g, ok := index[key.String()]
+		if !ok {
+			g = &group{labels: labels, sample: &prompb.Sample{Timestamp: smp.Timestamp}, stale: true}
+			index[key.String()] = g
+			groups = append(groups, g)
+		}
+		g.sample.Timestamp = max(g.sample.Timestamp, smp.Timestamp)
+		if IsStaleNaN(smp.Value) {
+			continue
+		}
+		g.stale = false
+		g.sample.Value += smp.Value
+	}
+
+	tsList := make([]*prompb.TimeSeries, 0, len(groups))
+	for _, g := range groups {
+		if g.stale {
+			g.sample.Value = StaleNaN
+		}
+		tsList = append(tsList, &prompb.TimeSeries{
+			Labels:  g.labels,
+			Samples: []*prompb.Sample{g.sample},
+		})
+	}
+	return tsList
+}
+
+// summableNames returns the series names of the counters and histograms described by the PBMetric,
+// nil if the PBMetric is not a PBDescriber
+func (a *Aggregation) summableNames() map[string]struct{} {
+	d, ok := a.m.(PBDescriber)
+	if !ok {
+		return nil
+	}
+	names := map[string]struct{}{}
+	for _, desc := range d.Descs() {
+		if !isSummableType(desc.Type) {
+			continue
+		}
+		for _, name := range seriesNames(desc) {
+			names[name] = struct{}{}
+		}
+	}
+	return names
+}
+
+func isSummableType(t prompb.MetricMetadata_MetricType) bool {
+	switch t {
+	case prompb.MetricMetadata_COUNTER, prompb.MetricMetadata_HISTOGRAM, prompb.MetricMetadata_GAUGEHISTOGRAM:
+		return true
+	default:
+		return false
+	}
+}
+
+// isSummable returns whether ts is a series of summable, or not a _created series if summable is nil
+func isSummable(ts *prompb.TimeSeries, summable map[string]struct{}) bool {
+	var name string
+	for _, l := range ts.Labels {
+		if l.Name == model.MetricNameLabel {
+			name = l.Value
+			break
+		}
+	}
+	if summable == nil {
+		return !strings.HasSuffix(name, "_created")
+	}
+	_, ok := summable[name]
+	return ok
+}
+
+// Implement PBDescriber interface
+// The labels aggregated away are removed from the Desc of the PBMetric, the Descs of gauges and summaries are dropped
+func (a *Aggregation) Descs() []*Desc {
+	d, ok := a.m.(PBDescriber)
+	if !ok {
+		return nil
+	}
+	descs := d.Descs()
+	reduced := make([]*Desc, 0, len(descs))
+	for _, desc := range descs {
+		if !isSummableType(desc.Type) {
+			continue
+		}
+		r := *desc
+		r.Labels = slices.DeleteFunc(slices.Clone(desc.Labels), func(label string) bool {
+			return slices.Contains(a.without, label)
+		})
+		if len(desc.ConstLabels) > 0 {
+			r.ConstLabels = make(map[string]string, len(desc.ConstLabels))
+			for label, value := range desc.ConstLabels {
+				if !slices.Contains(a.without, label) {
+					r.ConstLabels[label] = value
+				}
+			}
+		}
+		reduced = append(reduced, &r)
+	}
+	return reduced
+}
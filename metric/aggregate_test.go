@@ -0,0 +1,75 @@
+package metric
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSumWithout(t *testing.T) {
+	c := NewPBCounter("test_total", "test", []string{"method", "pod"}, WithStaleMarkers(), WithCreatedSeries())
+	c.Add([]string{"GET", "a"}, 1)
+	c.Add([]string{"GET", "b"}, 2)
+	c.Add([]string{"POST", "a"}, 3)
+	c.Add([]string{"PUT", "a"}, 4)
+	c.Delete([]string{"PUT", "a"})
+	hg := NewPBHistogram("test_histogram", "test", []string{"pod"}, []float64{1})
+	hg.Observe([]string{"a"}, 0.5)
+	hg.Observe([]string{"b"}, 2)
+	g := NewGaugeVecFunc("test_gauge", "test", []string{"pod"}, func() []FuncSample {
+		return []FuncSample{{LabelValues: []string{"a"}, Value: 1}, {LabelValues: []string{"b"}, Value: 2}}
+	})
+
+	tests := []struct {
+		name string
+		m    PBMetric
+		want map[string]float64
+	}{
+		{
+			name: "counter",
+			m:    c,
+			want: map[string]float64{
+				`test_total{method="GET"}`:  3,
+				`test_total{method="POST"}`: 3,
+				`test_total{method="PUT"}`:  StaleNaN,
+			},
+		},
+		{
+			name: "gauge",
+			m:    g,
+			want: map[string]float64{},
+		},
+		{
+			name: "histogram",
+			m:    hg,
+			want: map[string]float64{
+				`test_histogram_bucket{le="1"}`:    1,
+				`test_histogram_bucket{le="+Inf"}`: 2,
+				`test_histogram_sum{}`:             2.5,
+				`test_histogram_count{}`:           2,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := SumWithout(tt.m, "pod")
+			got := map[string]float64{}
+			for _, ts := range a.TimeSeries(1) {
+				got[seriesString(ts)] = ts.Samples[0].Value
+			}
+			// StaleNaN != StaleNaN, compare staleness markers separately
+			for k, v := range got {
+				if IsStaleNaN(v) && IsStaleNaN(tt.want[k]) {
+					got[k], tt.want[k] = 0, 0
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Aggregation.TimeSeries() = %v, want %v", got, tt.want)
+			}
+			for _, desc := range a.Descs() { // no Desc of the gauge
+				if len(desc.Labels) != len(tt.m.(PBDescriber).Descs()[0].Labels)-1 {
+					t.Errorf("Aggregation.Descs() labels = %v", desc.Labels)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package metric
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var ErrInvalidBuckets = errors.New("invalid histogram buckets")
+
+// DefaultBuckets are used by NewPBHistogram if no buckets are given, they are tuned for latencies in ms
+var DefaultBuckets = []float64{25, 50, 75, 100, 200, 500, 1000}
+
+// LinearBuckets creates count buckets, each width wide, where the lowest bucket has an upper bound of start.
+// It panics if count < 1, same as prometheus.LinearBuckets.
+func LinearBuckets(start, width float64, count int) []float64 {
+	return prometheus.LinearBuckets(start, width, count)
+}
+
+// ExponentialBuckets creates count buckets, where the lowest bucket has an upper bound of start
+// and each following bucket's upper bound is factor times the previous one.
+// It panics if count < 1, start <= 0 or factor <= 1, same as prometheus.ExponentialBuckets.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	return prometheus.ExponentialBuckets(start, factor, count)
+}
+
+// ExponentialBucketsRange creates count buckets, where the lowest bucket is min and the highest bucket is max,
+// and the upper bounds grow exponentially between them.
+// It panics if count < 1 or min <= 0, same as prometheus.ExponentialBucketsRange.
+func ExponentialBucketsRange(min, max float64, count int) []float64 {
+	return prometheus.ExponentialBucketsRange(min, max, count)
+}
+
+// validateBuckets checks the upper bounds are ascending and unique without NaN and -Inf,
+// +Inf is allowed only as the last upper bound.
+// The upper bounds without +Inf are returned, the +Inf bucket is generated by count.
+func validateBuckets(buckets []float64) ([]float64, error) {
+	for i, b := range buckets {
+		switch {
+		case math.IsNaN(b):
+			return nil, fmt.Errorf("%w: NaN upper bound at index %d", ErrInvalidBuckets, i)
+		case math.IsInf(b, -1):
+			return nil, fmt.Errorf("%w: -Inf upper bound at index %d", ErrInvalidBuckets, i)
+		case i > 0 && b <= buckets[i-1]:
+			return nil, fmt.Errorf("%w: upper bounds must be ascending and unique, got %v after %v at index %d",
+				ErrInvalidBuckets, b, buckets[i-1], i)
+		}
+	}
+	if n := len(buckets); n > 0 && math.IsInf(buckets[n-1], 1) {
+		buckets = buckets[:n-1]
+	}
+	return slices.Clone(buckets), nil
+}
@@ -0,0 +1,156 @@
+package metric
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/sq325/remoteWrite/prompb"
+)
+
+// BufferDroppedCounter counts the buffered samples dropped because the cap of a Buffer was hit,
+// register it with RegisterInternalMetrics
+var BufferDroppedCounter = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "remotewrite_buffer_dropped_samples_total",
+		Help: "Total number of buffered samples dropped because the max samples per series of the buffer was hit",
+	},
+)
+
+// PBMetricFunc adapts a func to PBMetric, e.g. PBMetricFunc(registry.Gather)
+type PBMetricFunc func(timestamp int64) []*prompb.TimeSeries
+
+// Implement PBMetric interface
+func (f PBMetricFunc) TimeSeries(timestamp int64) []*prompb.TimeSeries {
+	return f(timestamp)
+}
+
+// Buffer snapshots the TimeSeries of a PBMetric at a sub-interval of the push interval,
+// and emits all snapshots as multiple samples per series on TimeSeries,
+// e.g. 1s resolution with a 30s push interval.
+// At most maxSamples samples are buffered per series, the oldest ones are dropped and counted by BufferDroppedCounter.
+// Buffer is safe for concurrent use.
+// Buffer implements PBMetric
+type Buffer struct {
+	m          PBMetric
+	maxSamples int
+
+	snapshotMtx sync.Mutex // serializes Snapshot, so that the samples of a series are in timestamp order
+
+	mtx    sync.Mutex
+	series []*bufferedSeries          // in order of first snapshot
+	index  map[string]*bufferedSeries // labels -> series
+	last   int64                      // timestamp of the last snapshot
+}
+
+type bufferedSeries struct {
+	labels     []*prompb.Label
+	samples    []*prompb.Sample
+	histograms []*prompb.Histogram
+}
+
+var _ PBMetric = (*Buffer)(nil)
+
+// maxSamples <= 0 means no limit
+func NewBuffer(m PBMetric, maxSamples int) *Buffer {
+	return &Buffer{
+		m:          m,
+		maxSamples: maxSamples,
+		index:      map[string]*bufferedSeries{},
+	}
+}
+
+// Snapshot buffers the TimeSeries of the PBMetric at timestamp
+// The snapshot is skipped if timestamp is not after the last snapshot,
+// as the samples of a series must be in timestamp order.
+// timestamp: timestamp is in ms format
+func (b *Buffer) Snapshot(timestamp int64) {
+	b.snapshotMtx.Lock()
+	defer b.snapshotMtx.Unlock()
+
+	b.mtx.Lock()
+	last := b.last
+	b.mtx.Unlock()
+	if timestamp <= last {
+		return
+	}
+	tsList := b.m.TimeSeries(timestamp)
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.last = timestamp
+	for _, ts := range tsList {
+		key := labelsKey(ts.Labels)
+		s, ok := b.index[key]
+		if !ok {
+			s = &bufferedSeries{labels: ts.Labels}
+			b.index[key] = s
+			b.series = append(b.series, s)
+		}
+		s.samples = truncate(b.maxSamples, append(s.samples, ts.Samples...))
+		s.histograms = truncate(b.maxSamples, append(s.histograms, ts.Histograms...))
+	}
+}
+
+// truncate drops the oldest samples over maxSamples
+func truncate[T any](maxSamples int, samples []T) []T {
+	if maxSamples <= 0 || len(samples) <= maxSamples {
+		return samples
+	}
+	dropped := len(samples) - maxSamples
+	BufferDroppedCounter.Add(float64(dropped))
+	return append(samples[:0], samples[dropped:]...)
+}
+
+// Run snapshots every interval until ctx is done
+func (b *Buffer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t := <-ticker.C:
+			b.Snapshot(t.UnixMilli())
+		}
+	}
+}
+
+// Implement PBMetric interface
+// A snapshot is taken at timestamp unless timestamp is not after the last snapshot, see Snapshot,
+// then all buffered samples are returned and the buffer is cleared.
+// timestamp: timestamp is in ms format
+func (b *Buffer) TimeSeries(timestamp int64) []*prompb.TimeSeries {
+	b.Snapshot(timestamp)
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	tsList := make([]*prompb.TimeSeries, 0, len(b.series))
+	for _, s := range b.series {
+		tsList = append(tsList, &prompb.TimeSeries{
+			Labels:     s.labels,
+			Samples:    s.samples,
+			Histograms: s.histograms,
+		})
+	}
+	b.series = nil
+	b.index = map[string]*bufferedSeries{}
+	return tsList
+}
+
+func labelsKey(labels []*prompb.Label) string {
+	var sb strings.Builder
+	for _, l := range labels {
+		sb.WriteString(l.Name)
+		sb.WriteByte(model.SeparatorByte)
+		sb.WriteString(l.Value)
+		sb.WriteByte(model.SeparatorByte)
+	}
+	return sb.String()
+}
@@ -0,0 +1,63 @@
+package metric
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestBuffer(t *testing.T) {
+	c := NewPBCounter("test_total", "test", []string{"label1"})
+	b := NewBuffer(c, 3)
+
+	before := testutil.ToFloat64(BufferDroppedCounter)
+	for i, ts := range []int64{1000, 2000, 3000, 4000} {
+		c.Add([]string{"a"}, float64(i+1))
+		b.Snapshot(ts)
+	}
+	dropped := testutil.ToFloat64(BufferDroppedCounter) - before
+
+	tsList := b.TimeSeries(4000) // same timestamp as the last snapshot, no new snapshot
+	if len(tsList) != 1 {
+		t.Fatalf("Buffer.TimeSeries() = %d series, want 1", len(tsList))
+	}
+	var got [][2]float64
+	for _, smp := range tsList[0].Samples {
+		got = append(got, [2]float64{float64(smp.Timestamp), smp.Value})
+	}
+	if want := [][2]float64{{2000, 3}, {3000, 6}, {4000, 10}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Buffer.TimeSeries() samples = %v, want %v", got, want)
+	}
+	if dropped != 1 {
+		t.Errorf("BufferDroppedCounter delta = %v, want %v", dropped, 1)
+	}
+
+	// the buffer is cleared, a snapshot is taken at the push timestamp
+	tsList = b.TimeSeries(5000)
+	if len(tsList) != 1 || len(tsList[0].Samples) != 1 || tsList[0].Samples[0].Timestamp != 5000 {
+		t.Errorf("Buffer.TimeSeries() after clear = %v", tsList)
+	}
+}
+
+func TestBuffer_OutOfOrder(t *testing.T) {
+	c := NewPBCounter("test_total", "test", []string{"label1"})
+	b := NewBuffer(c, 0)
+
+	c.Inc([]string{"a"})
+	b.Snapshot(2000)
+	b.Snapshot(1000) // skipped
+
+	// the push timestamp is before the last snapshot, no snapshot is taken
+	tsList := b.TimeSeries(1500)
+	if len(tsList) != 1 {
+		t.Fatalf("Buffer.TimeSeries() = %d series, want 1", len(tsList))
+	}
+	var got []int64
+	for _, smp := range tsList[0].Samples {
+		got = append(got, smp.Timestamp)
+	}
+	if want := []int64{2000}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Buffer.TimeSeries() timestamps = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,189 @@
+package metric
+
+import (
+	"cmp"
+	"log/slog"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/sq325/remoteWrite/prompb"
+	"google.golang.org/protobuf/proto"
+)
+
+// ChangeOnly is a view over a PBMetric which emits only the series whose value changed since the last successful push,
+// an unchanged series is still emitted once per heartbeat so that it does not go stale in Prometheus, e.g.
+//
+//	co := NewChangeOnly(m, time.Minute)
+//	if err := client.Write(co.TimeSeries(ts)); err == nil {
+//		co.Commit()
+//	}
+//
+// Staleness markers are always emitted.
+// The series emitted but not committed are emitted again by the next TimeSeries call with their samples,
+// so the staleness markers and the samples drained by the PBMetric, e.g. Buffer, are not lost by a failed push.
+// The uncommitted samples accumulate while the pushes keep failing.
+// ChangeOnly is safe for concurrent use, but TimeSeries and Commit of a push must not interleave with another push.
+// ChangeOnly implements PBMetric
+type ChangeOnly struct {
+	m         PBMetric
+	heartbeat int64 // ms
+
+	mtx     sync.Mutex
+	sent    map[string]*sentSeries // labels -> the last successfully pushed value
+	pending map[string]*sentSeries // labels -> the value emitted by the last TimeSeries call, nil for skipped series
+	unacked []*prompb.TimeSeries   // series emitted since the last Commit
+}
+
+// sentSeries is the last value of a series and the timestamp it was pushed
+type sentSeries struct {
+	value     float64
+	histogram *prompb.Histogram // timestamp is cleared for comparison
+	timestamp int64
+}
+
+var _ PBMetric = (*ChangeOnly)(nil)
+
+// lookbackDelta is the default lookback delta of Prometheus, a series without sample within it is stale
+const lookbackDelta = 5 * time.Minute
+
+// heartbeat must be less than the lookback delta of Prometheus, 5m by default, minus the push interval,
+// otherwise an unchanged series goes stale between heartbeats, a warning is logged if heartbeat >= 5m.
+// heartbeat <= 0 means an unchanged series is never emitted again, which makes it stale in Prometheus.
+func NewChangeOnly(m PBMetric, heartbeat time.Duration) *ChangeOnly {
+	if heartbeat >= lookbackDelta {
+		slog.Warn("ChangeOnly heartbeat is not less than the lookback delta of Prometheus, unchanged series may go stale",
+			"heartbeat", heartbeat, "lookbackDelta", lookbackDelta)
+	}
+	return &ChangeOnly{
+		m:         m,
+		heartbeat: heartbeat.Milliseconds(),
+		sent:      map[string]*sentSeries{},
+	}
+}
+
+// Implement PBMetric interface
+// The series of the PBMetric are compared with the last committed push by their last sample,
+// the series emitted since the last Commit are emitted again, see ChangeOnly.
+// timestamp: timestamp is in ms format
+func (co *ChangeOnly) TimeSeries(timestamp int64) []*prompb.TimeSeries {
+	tsList := co.m.TimeSeries(timestamp)
+
+	co.mtx.Lock()
+	defer co.mtx.Unlock()
+
+	co.pending = make(map[string]*sentSeries, len(tsList))
+	changed := make([]*prompb.TimeSeries, 0, len(tsList))
+	for _, ts := range tsList {
+		key := labelsKey(ts.Labels)
+		cur := lastValue(ts)
+		if cur == nil {
+			continue
+		}
+		last, ok := co.sent[key]
+		if ok && last.equal(cur) && (co.heartbeat <= 0 || timestamp-last.timestamp < co.heartbeat) {
+			co.pending[key] = nil // keep the committed value
+			continue
+		}
+		cur.timestamp = timestamp
+		co.pending[key] = cur
+		changed = append(changed, ts)
+	}
+	co.unacked = withUnacked(changed, co.unacked)
+	return co.unacked
+}
+
+// withUnacked adds the series emitted but not committed to tsList,
+// the samples and histograms of a series also in tsList are prepended if earlier
+func withUnacked(tsList, unacked []*prompb.TimeSeries) []*prompb.TimeSeries {
+	if len(unacked) == 0 {
+		return tsList
+	}
+	index := make(map[string]int, len(tsList))
+	for i, ts := range tsList {
+		index[labelsKey(ts.Labels)] = i
+	}
+	for _, u := range unacked {
+		i, ok := index[labelsKey(u.Labels)]
+		if !ok {
+			tsList = append(tsList, u)
+			continue
+		}
+		ts := tsList[i]
+		tsList[i] = &prompb.TimeSeries{
+			Labels:     ts.Labels,
+			Samples:    append(earlierSamples(u.Samples, ts.Samples), ts.Samples...),
+			Exemplars:  ts.Exemplars,
+			Histograms: append(earlierHistograms(u.Histograms, ts.Histograms), ts.Histograms...),
+		}
+	}
+	return tsList
+}
+
+// earlierSamples returns the samples of old earlier than the first sample of cur
+func earlierSamples(old, cur []*prompb.Sample) []*prompb.Sample {
+	if len(cur) == 0 {
+		return slices.Clone(old)
+	}
+	i, _ := slices.BinarySearchFunc(old, cur[0].Timestamp, func(s *prompb.Sample, t int64) int { return cmp.Compare(s.Timestamp, t) })
+	return slices.Clone(old[:i])
+}
+
+// earlierHistograms returns the histograms of old earlier than the first histogram of cur
+func earlierHistograms(old, cur []*prompb.Histogram) []*prompb.Histogram {
+	if len(cur) == 0 {
+		return slices.Clone(old)
+	}
+	i, _ := slices.BinarySearchFunc(old, cur[0].Timestamp, func(h *prompb.Histogram, t int64) int { return cmp.Compare(h.Timestamp, t) })
+	return slices.Clone(old[:i])
+}
+
+// Commit marks the series emitted by the last TimeSeries call as pushed successfully,
+// it should be called after the write succeeds, otherwise the series are emitted again by the next TimeSeries call.
+// Series not generated by the last TimeSeries call or marked stale are forgotten.
+func (co *ChangeOnly) Commit() {
+	co.mtx.Lock()
+	defer co.mtx.Unlock()
+
+	co.unacked = nil
+	if co.pending == nil {
+		return
+	}
+	for key := range co.sent {
+		if _, ok := co.pending[key]; !ok {
+			delete(co.sent, key)
+		}
+	}
+	for key, cur := range co.pending {
+		switch {
+		case cur == nil:
+		case cur.histogram == nil && IsStaleNaN(cur.value):
+			delete(co.sent, key)
+		default:
+			co.sent[key] = cur
+		}
+	}
+	co.pending = nil
+}
+
+// lastValue returns the last sample or histogram of ts, nil if ts has none
+func lastValue(ts *prompb.TimeSeries) *sentSeries {
+	if n := len(ts.Histograms); n > 0 {
+		h := proto.Clone(ts.Histograms[n-1]).(*prompb.Histogram)
+		h.Timestamp = 0
+		return &sentSeries{histogram: h}
+	}
+	if n := len(ts.Samples); n > 0 {
+		return &sentSeries{value: ts.Samples[n-1].Value}
+	}
+	return nil
+}
+
+func (s *sentSeries) equal(other *sentSeries) bool {
+	if s.histogram != nil || other.histogram != nil {
+		return proto.Equal(s.histogram, other.histogram)
+	}
+	// compare bits, so that NaN equals NaN
+	return math.Float64bits(s.value) == math.Float64bits(other.value)
+}
@@ -0,0 +1,110 @@
+package metric
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChangeOnly(t *testing.T) {
+	c := NewPBCounter("test_total", "test", []string{"label1"}, WithStaleMarkers())
+	co := NewChangeOnly(c, time.Minute)
+
+	c.Add([]string{"a"}, 1)
+	c.Add([]string{"b"}, 1)
+	if tsList := co.TimeSeries(1000); len(tsList) != 2 {
+		t.Fatalf("ChangeOnly.TimeSeries() = %d series, want 2", len(tsList))
+	}
+	// the push failed, the series are emitted again
+	if tsList := co.TimeSeries(2000); len(tsList) != 2 {
+		t.Fatalf("ChangeOnly.TimeSeries() without commit = %d series, want 2", len(tsList))
+	}
+	co.Commit()
+
+	c.Add([]string{"a"}, 1)
+	tsList := co.TimeSeries(3000)
+	if len(tsList) != 1 || seriesString(tsList[0]) != `test_total{label1="a"}` {
+		t.Fatalf("ChangeOnly.TimeSeries() after change = %v, want only label1=a", tsList)
+	}
+	co.Commit()
+
+	// b was pushed at 2000, the heartbeat elapses at 62000
+	if tsList := co.TimeSeries(61000); len(tsList) != 0 {
+		t.Errorf("ChangeOnly.TimeSeries() before heartbeat = %d series, want 0", len(tsList))
+	}
+	co.Commit()
+	tsList = co.TimeSeries(62000)
+	if len(tsList) != 1 || seriesString(tsList[0]) != `test_total{label1="b"}` {
+		t.Errorf("ChangeOnly.TimeSeries() at heartbeat = %v, want only label1=b", tsList)
+	}
+	co.Commit()
+
+	// staleness markers are always emitted
+	c.Delete([]string{"a"})
+	tsList = co.TimeSeries(63000)
+	if len(tsList) != 1 || !IsStaleNaN(tsList[0].Samples[0].Value) {
+		t.Fatalf("ChangeOnly.TimeSeries() after delete = %v, want a staleness marker", tsList)
+	}
+	co.Commit()
+
+	// a recreated series with the same value is emitted
+	c.Add([]string{"a"}, 2)
+	if tsList := co.TimeSeries(64000); len(tsList) != 1 {
+		t.Errorf("ChangeOnly.TimeSeries() after recreate = %d series, want 1", len(tsList))
+	}
+}
+
+func TestChangeOnly_Uncommitted(t *testing.T) {
+	c := NewPBCounter("test_total", "test", []string{"label1"}, WithStaleMarkers())
+	b := NewBuffer(c, 10)
+	co := NewChangeOnly(b, time.Minute)
+
+	c.Inc([]string{"a"})
+	c.Inc([]string{"b"})
+	co.TimeSeries(1000)
+	co.Commit()
+
+	// the staleness marker and the buffered samples drained by the failed push are emitted again
+	c.Delete([]string{"a"})
+	c.Inc([]string{"b"})
+	b.Snapshot(1500)
+	co.TimeSeries(2000)
+	c.Inc([]string{"b"})
+	got := map[string][]int64{}
+	for _, ts := range co.TimeSeries(3000) {
+		for _, smp := range ts.Samples {
+			got[seriesString(ts)] = append(got[seriesString(ts)], smp.Timestamp)
+		}
+	}
+	want := map[string][]int64{
+		`test_total{label1="a"}`: {1500}, // staleness marker of the snapshot
+		`test_total{label1="b"}`: {1500, 2000, 3000},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ChangeOnly.TimeSeries() after failed push = %v, want %v", got, want)
+	}
+	co.Commit()
+
+	if tsList := co.TimeSeries(4000); len(tsList) != 0 {
+		t.Errorf("ChangeOnly.TimeSeries() after commit = %d series, want 0", len(tsList))
+	}
+}
+
+func TestChangeOnlyHistogram(t *testing.T) {
+	hg := NewPBHistogram("test_seconds", "test", nil, []float64{1, 2}, WithNativeSchema(0))
+	co := NewChangeOnly(hg, time.Minute)
+
+	hg.Observe(nil, 0.5)
+	first := len(co.TimeSeries(1000))
+	co.Commit()
+	if tsList := co.TimeSeries(2000); len(tsList) != 0 {
+		t.Errorf("ChangeOnly.TimeSeries() unchanged = %d series, want 0", len(tsList))
+	}
+	co.Commit()
+
+	// the le="1" bucket is unchanged
+	hg.Observe(nil, 1.5)
+	if tsList := co.TimeSeries(3000); len(tsList) != first-1 {
+		t.Errorf("ChangeOnly.TimeSeries() after observe = %d series, want %d", len(tsList), first-1)
+	}
+}
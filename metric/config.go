@@ -0,0 +1,161 @@
+package metric
+
+import (
+	"maps"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type config struct {
+	Namespace   string
+	Subsystem   string
+	ConstLabels prometheus.Labels
+
+	StaleMarkers bool
+	TTL          time.Duration
+	MaxSeries    int
+
+	NativeHistogram bool
+	NativeSchema    int32
+
+	DurationUnit time.Duration
+
+	CreatedSeries      bool
+	CreatedZeroSamples bool
+
+	now func() time.Time // for testing
+}
+
+func newConfig(opts ...Option) *config {
+	c := &config{
+		DurationUnit: time.Millisecond,
+		now:          time.Now,
+	}
+
+	for _, opt := range opts {
+		opt.apply(c)
+	}
+
+	return c
+}
+
+type Option interface {
+	apply(*config)
+}
+
+// optionFunc wraps a func so it satisfies the Option interface.
+type optionFunc func(*config)
+
+func (f optionFunc) apply(c *config) {
+	f(c)
+}
+
+// WithNamespace sets the namespace of the metric name,
+// the fully qualified name is namespace_subsystem_name as client_golang builds it.
+func WithNamespace(namespace string) Option {
+	return optionFunc(func(c *config) {
+		c.Namespace = namespace
+	})
+}
+
+// WithSubsystem sets the subsystem of the metric name, see WithNamespace
+func WithSubsystem(subsystem string) Option {
+	return optionFunc(func(c *config) {
+		c.Subsystem = subsystem
+	})
+}
+
+// WithConstLabels adds labels with fixed values to every series of the metric, e.g. service and region.
+// Const label names must not be variable label names of the metric.
+// Labels with empty value are dropped as variable labels.
+func WithConstLabels(labels prometheus.Labels) Option {
+	return optionFunc(func(c *config) {
+		c.ConstLabels = maps.Clone(labels)
+	})
+}
+
+// fqName returns the fully qualified name of name, see WithNamespace
+func (c *config) fqName(name string) string {
+	return prometheus.BuildFQName(c.Namespace, c.Subsystem, name)
+}
+
+// WithStaleMarkers makes the metric emit a staleness marker for each deleted series on the next TimeSeries call
+func WithStaleMarkers() Option {
+	return optionFunc(func(c *config) {
+		c.StaleMarkers = true
+	})
+}
+
+// WithTTL makes the label values not updated within ttl expire.
+// An expired label values is deleted and generates a staleness marker on the next TimeSeries call.
+// ttl <= 0 means never expire, which is the default.
+func WithTTL(ttl time.Duration) Option {
+	return optionFunc(func(c *config) {
+		c.TTL = ttl
+	})
+}
+
+// WithMaxSeries limits the number of label values of the metric.
+// Once the limit is hit, new label values are folded into a single overflow series
+// whose label values are all OverflowLabelValue, the distinct label values folded are counted by SeriesOverflowCounter.
+// n <= 0 means no limit, which is the default.
+// For PBHistogram, the limit applies to the label values without bucket_label.
+func WithMaxSeries(n int) Option {
+	return optionFunc(func(c *config) {
+		c.MaxSeries = n
+	})
+}
+
+// WithNativeSchema makes PBHistogram emit a native histogram series of the exponential schema
+// in addition to the classic _bucket, _sum and _count series, e.g. to migrate dashboards to native histograms.
+// The classic buckets are mapped into the native buckets, so the resolution is not better than the classic buckets.
+// schema must be in [-4, 8], the base of the buckets is 2^(2^-schema).
+// Custom bucket boundaries (schema -53) are not supported, as the prompb.Histogram has no custom values.
+func WithNativeSchema(schema int32) Option {
+	return optionFunc(func(c *config) {
+		c.NativeHistogram = true
+		c.NativeSchema = schema
+	})
+}
+
+// WithDurationUnit sets the unit of the durations observed by Timer and Time,
+// the default is time.Millisecond to match DefaultBuckets, which are tuned for ms.
+// Use time.Second with buckets in seconds, e.g. prometheus.DefBuckets.
+// unit <= 0 is ignored.
+func WithDurationUnit(unit time.Duration) Option {
+	return optionFunc(func(c *config) {
+		if unit > 0 {
+			c.DurationUnit = unit
+		}
+	})
+}
+
+// WithCreatedSeries makes PBCounter and PBHistogram emit a <name>_created series for each label values,
+// whose value is the created timestamp in seconds as OpenMetrics, the _total suffix of name is dropped.
+// The created timestamp is the time the label values was created, or reset by SetTotal.
+// The created timestamp field of Remote Write 2.0 is not supported, as prompb implements Remote Write 1.0.
+func WithCreatedSeries() Option {
+	return optionFunc(func(c *config) {
+		c.CreatedSeries = true
+	})
+}
+
+// WithCreatedZeroSamples makes PBCounter and PBHistogram inject a sample of value 0 at the created timestamp
+// before the first sample of each new label values, so that the first push after a restart is seen as a reset.
+// The zero sample is injected once, in the first TimeSeries call after the label values is created or reset.
+// It stands in for the created timestamp field of Remote Write 2.0, which prompb does not support, see WithCreatedSeries.
+func WithCreatedZeroSamples() Option {
+	return optionFunc(func(c *config) {
+		c.CreatedZeroSamples = true
+	})
+}
+
+// withoutCreated disables WithCreatedSeries and WithCreatedZeroSamples for the underlying Vecs of PBHistogram,
+// which are handled by PBHistogram itself
+func withoutCreated() Option {
+	return optionFunc(func(c *config) {
+		c.CreatedSeries = false
+		c.CreatedZeroSamples = false
+	})
+}
@@ -1,7 +1,12 @@
 package metric
 
 import (
+	"fmt"
 	"log/slog"
+	"math"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sq325/remoteWrite/prompb"
@@ -15,89 +20,211 @@ type PBCounterMeter interface {
 }
 
 type PBCounter struct {
-	vec *Vec
+	vec  *Vec
+	help string
+
+	totalMtx sync.Mutex // serializes SetTotal
 }
 
-func NewPBCounter(name string, help string, labels []string) *PBCounter {
+var (
+	_ PBDescriber          = (*PBCounter)(nil)
+	_ prometheus.Collector = (*PBCounter)(nil)
+)
+
+// NewPBCounter panics if name or labels are invalid, see ValidateDesc
+// name is prefixed by WithNamespace and WithSubsystem
+func NewPBCounter(name string, help string, labels []string, opts ...Option) *PBCounter {
+	cfg := newConfig(opts...)
+	fqName := cfg.fqName(name)
+	if err := validateDescWithConstLabels(fqName, labels, cfg.ConstLabels); err != nil {
+		panic(err)
+	}
 	return &PBCounter{
-		vec: NewVec(name, labels,
-			&counterVec{
-				cv: prometheus.NewCounterVec(
-					prometheus.CounterOpts{
-						Name: name,
-						Help: help,
-					},
-					labels,
-				),
-			},
-		),
+		help: help,
+		vec:  NewVec(name, labels, newCounterVec(fqName, help, labels, cfg.ConstLabels), opts...),
 	}
 }
 
-// timestamp: timestamp is in ms format
-func (c *PBCounter) TimeSeries(timestamp int64) []*prompb.TimeSeries {
-	n := len(c.vec.LabelValues())
-	if n == 0 {
-		return nil
-	}
+// Name return the name of metric
+func (c *PBCounter) Name() string {
+	return c.vec.Name()
+}
 
-	tsList := make([]*prompb.TimeSeries, 0, n)
-	// A lvs generate a TimeSeries
-	for _, lvs := range c.vec.LabelValues() {
-		if len(lvs) != len(c.vec.Labels()) {
-			slog.Error("labels and labelvalues not match", "labels", c.vec.Labels(), "labelvalues", lvs)
-			continue
-		}
-		m, err := c.vec.GetMetricWithLabelValues(lvs...)
-		if err != nil {
-			continue
-		}
-		v, err := GetMetricValue(m)
-		if err != nil {
-			slog.Error("GetMetricValue Failed", "err", err)
-		}
+// Labels not include __name__
+func (c *PBCounter) Labels() []string {
+	return c.vec.Labels()
+}
 
-		labels := make([]*prompb.Label, 0, len(c.vec.Labels())+1) // +1 for __name__
-		{
-			labels = append(labels, &prompb.Label{
-				Name:  "__name__",
-				Value: c.vec.Name(),
-			})
-			for i, label := range c.vec.Labels() {
-				labels = append(labels, &prompb.Label{
-					Name:  label,
-					Value: lvs[i],
-				})
-			}
-		}
+func (c *PBCounter) LabelValues() [][]string {
+	return c.vec.LabelValues()
+}
 
-		sample := &prompb.Sample{
-			Value:     v,
-			Timestamp: timestamp,
-		}
+// Implement PBDescriber interface
+// The created series is described as a gauge if WithCreatedSeries is set
+func (c *PBCounter) Descs() []*Desc {
+	desc := &Desc{
+		Name:   c.vec.Name(),
+		Help:   c.help,
+		Type:   prompb.MetricMetadata_COUNTER,
+		Labels: c.vec.Labels(),
 
-		ts := &prompb.TimeSeries{
-			Labels:  labels,
-			Samples: []*prompb.Sample{sample},
-		}
-		tsList = append(tsList, ts)
+		ConstLabels: c.vec.cfg.ConstLabels,
 	}
+	if c.vec.cfg.CreatedSeries {
+		return []*Desc{desc, createdDesc(desc)}
+	}
+	return []*Desc{desc}
+}
 
-	return tsList
+// Implement prometheus.Collector interface, the underlying CounterVec is collected
+func (c *PBCounter) Describe(ch chan<- *prometheus.Desc) {
+	c.vec.Describe(ch)
 }
 
+// Implement prometheus.Collector interface, the underlying CounterVec is collected
+func (c *PBCounter) Collect(ch chan<- prometheus.Metric) {
+	c.vec.Collect(ch)
+}
+
+// timestamp: timestamp is in ms format
+func (c *PBCounter) TimeSeries(timestamp int64) []*prompb.TimeSeries {
+	return c.vec.TimeSeries(timestamp)
+}
+
+// Errors are logged, use TryAdd to handle them
 func (c *PBCounter) Add(lvs []string, value float64) {
 	c.vec.Add(lvs, value)
 }
 
+// Errors are logged, use TryInc to handle them
 func (c *PBCounter) Inc(lvs []string) {
 	c.vec.Inc(lvs)
 }
 
-func (c *PBCounter) GetValue(lvs []string) (float64, error) {
-	m, err := c.vec.GetMetricWithLabelValues(lvs...)
+// TryAdd returns ErrLabelValuesMismatch, ErrInvalidUTF8 or ErrNegativeValue instead of panicking
+func (c *PBCounter) TryAdd(lvs []string, value float64) error {
+	return c.vec.TryAdd(lvs, value)
+}
+
+// TryInc returns ErrLabelValuesMismatch or ErrInvalidUTF8 instead of panicking
+func (c *PBCounter) TryInc(lvs []string) error {
+	return c.vec.TryInc(lvs)
+}
+
+// AddWith is like Add but takes labels instead of label values, errors are logged
+func (c *PBCounter) AddWith(labels prometheus.Labels, value float64) {
+	if err := c.TryAddWith(labels, value); err != nil {
+		slog.Error("PBCounter.AddWith failed", "name", c.Name(), "labels", labels, "value", value, "err", err)
+	}
+}
+
+// IncWith is like Inc but takes labels instead of label values, errors are logged
+func (c *PBCounter) IncWith(labels prometheus.Labels) {
+	if err := c.TryIncWith(labels); err != nil {
+		slog.Error("PBCounter.IncWith failed", "name", c.Name(), "labels", labels, "err", err)
+	}
+}
+
+// TryAddWith is like TryAdd but takes labels instead of label values
+// labels must contain exactly the labels of PBCounter
+func (c *PBCounter) TryAddWith(labels prometheus.Labels, value float64) error {
+	lvs, err := c.vec.labelValues(labels)
 	if err != nil {
-		return 0, err
+		return err
 	}
-	return GetMetricValue(m)
+	return c.vec.TryAdd(lvs, value)
+}
+
+// TryIncWith is like TryInc but takes labels instead of label values
+// labels must contain exactly the labels of PBCounter
+func (c *PBCounter) TryIncWith(labels prometheus.Labels) error {
+	lvs, err := c.vec.labelValues(labels)
+	if err != nil {
+		return err
+	}
+	return c.vec.TryInc(lvs)
+}
+
+// SetTotal sets the counter to an absolute total read from an external source, e.g. /proc or device counters.
+// A total less than the current value is taken as a reset of the source,
+// the label values is recreated with the total and a new created timestamp, see WithCreatedSeries.
+// Errors are logged, use TrySetTotal to handle them
+func (c *PBCounter) SetTotal(lvs []string, total float64) {
+	if err := c.TrySetTotal(lvs, total); err != nil {
+		slog.Error("PBCounter.SetTotal failed", "name", c.Name(), "labelvalues", lvs, "total", total, "err", err)
+	}
+}
+
+// TrySetTotal is like SetTotal but returns an error instead of logging it
+// It returns ErrNegativeValue if total is negative, ErrInvalidValue if total is NaN or infinite.
+// It returns ErrMaxSeries if the label values not exist and the limit of WithMaxSeries is hit,
+// as an absolute total cannot be folded into the overflow series.
+// SetTotal should not be mixed with Add and Inc on the same label values.
+func (c *PBCounter) TrySetTotal(lvs []string, total float64) error {
+	if math.IsNaN(total) || math.IsInf(total, 0) {
+		return fmt.Errorf("%w: %v", ErrInvalidValue, total)
+	}
+	if total < 0 {
+		return fmt.Errorf("%w: %v", ErrNegativeValue, total)
+	}
+
+	c.totalMtx.Lock()
+	defer c.totalMtx.Unlock()
+
+	current, err := c.vec.Value(lvs)
+	if err != nil {
+		return err
+	}
+	if total < current {
+		slog.Info("counter reset detected", "name", c.Name(), "labelvalues", lvs, "current", current, "total", total)
+		c.vec.delete(lvs, false)
+		current = 0
+	}
+	s, err := c.vec.getOrCreateSeries(lvs, false)
+	if err != nil {
+		return err
+	}
+	s.m.(prometheus.Counter).Add(total - current)
+	return nil
+}
+
+// Created returns the time the label values was created or reset by SetTotal, false if the label values not exist
+func (c *PBCounter) Created(lvs []string) (time.Time, bool) {
+	return c.vec.Created(lvs)
+}
+
+func (c *PBCounter) GetValue(lvs []string) (float64, error) {
+	return c.vec.Value(lvs)
+}
+
+// Delete deletes the label values, return whether the label values existed
+func (c *PBCounter) Delete(lvs []string) bool {
+	return c.vec.Delete(lvs)
+}
+
+// DeletePartialMatch deletes all label values matching the given labels, return the number of deleted label values
+func (c *PBCounter) DeletePartialMatch(labels prometheus.Labels) int {
+	return c.vec.DeletePartialMatch(labels)
+}
+
+// Merge adds the value of each label values of other to c, other is not modified.
+// Merge is additive and one-shot, merging the same other again counts it twice,
+// Reset other after merging it to merge only the new increments next time.
+// other must have the same labels as c, otherwise ErrMergeMismatch is returned.
+func (c *PBCounter) Merge(other *PBCounter) error {
+	if !slices.Equal(c.Labels(), other.Labels()) {
+		return fmt.Errorf("%w: %s has labels %v, %s has labels %v",
+			ErrMergeMismatch, c.Name(), c.Labels(), other.Name(), other.Labels())
+	}
+	for _, smp := range other.vec.samples() {
+		if err := c.vec.TryAdd(smp.lvs, smp.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reset deletes all label values
+func (c *PBCounter) Reset() {
+	c.vec.Reset()
 }
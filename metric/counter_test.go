@@ -1,7 +1,15 @@
 package metric
 
 import (
+	"errors"
+	"math"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestPBCounter_GetValue(t *testing.T) {
@@ -45,3 +53,391 @@ func TestPBCounter_GetValue(t *testing.T) {
 		})
 	}
 }
+
+func TestPBCounter_TryAdd(t *testing.T) {
+	tests := []struct {
+		name    string
+		lvs     []string
+		value   float64
+		wantErr error
+	}{
+		{
+			name:  "ok",
+			lvs:   []string{"1", "2"},
+			value: 1,
+		},
+		{
+			name:    "too few label values",
+			lvs:     []string{"1"},
+			value:   1,
+			wantErr: ErrLabelValuesMismatch,
+		},
+		{
+			name:    "too many label values",
+			lvs:     []string{"1", "2", "3"},
+			value:   1,
+			wantErr: ErrLabelValuesMismatch,
+		},
+		{
+			name:    "negative value",
+			lvs:     []string{"1", "2"},
+			value:   -1,
+			wantErr: ErrNegativeValue,
+		},
+		{
+			name:    "invalid utf8",
+			lvs:     []string{"1", "\xff"},
+			value:   1,
+			wantErr: ErrInvalidUTF8,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewPBCounter("test", "test", []string{"label1", "label2"})
+			if err := c.TryAdd(tt.lvs, tt.value); !errors.Is(err, tt.wantErr) {
+				t.Errorf("PBCounter.TryAdd() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			// must not panic
+			c.Add(tt.lvs, tt.value)
+			c.Inc(tt.lvs)
+		})
+	}
+}
+
+func TestPBCounter_TryAddWith(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  prometheus.Labels
+		wantErr error
+	}{
+		{
+			name:   "ok",
+			labels: prometheus.Labels{"label2": "2", "label1": "1"},
+		},
+		{
+			name:    "missing label",
+			labels:  prometheus.Labels{"label1": "1"},
+			wantErr: ErrLabelValuesMismatch,
+		},
+		{
+			name:    "unknown label",
+			labels:  prometheus.Labels{"label1": "1", "label3": "3"},
+			wantErr: ErrLabelValuesMismatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewPBCounter("test", "test", []string{"label1", "label2"})
+			if err := c.TryAddWith(tt.labels, 2); !errors.Is(err, tt.wantErr) {
+				t.Errorf("PBCounter.TryAddWith() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if got, err := c.GetValue([]string{"1", "2"}); err != nil || got != 2 {
+				t.Errorf("PBCounter.GetValue() = %v, %v, want %v", got, err, 2)
+			}
+		})
+	}
+}
+
+func TestPBCounter_Delete(t *testing.T) {
+	c := NewPBCounter("test", "test", []string{"label1", "label2"}, WithStaleMarkers())
+	c.Inc([]string{"a", "1"})
+	c.Inc([]string{"a", "2"})
+	c.Inc([]string{"b", "1"})
+	c.TimeSeries(1)
+
+	if !c.Delete([]string{"b", "1"}) {
+		t.Errorf("PBCounter.Delete() = false, want true")
+	}
+	if c.Delete([]string{"b", "1"}) {
+		t.Errorf("PBCounter.Delete() = true, want false")
+	}
+	if got := c.DeletePartialMatch(prometheus.Labels{"label1": "a"}); got != 2 {
+		t.Errorf("PBCounter.DeletePartialMatch() = %d, want %d", got, 2)
+	}
+
+	tsList := c.TimeSeries(2)
+	if len(tsList) != 3 {
+		t.Fatalf("len(PBCounter.TimeSeries()) = %d, want %d", len(tsList), 3)
+	}
+	for _, ts := range tsList {
+		if !IsStaleNaN(ts.Samples[0].Value) {
+			t.Errorf("PBCounter.TimeSeries() %s = %v, want StaleNaN", seriesString(ts), ts.Samples[0].Value)
+		}
+	}
+	if tsList := c.TimeSeries(3); len(tsList) != 0 {
+		t.Errorf("len(PBCounter.TimeSeries()) = %d, want %d", len(tsList), 0)
+	}
+
+	// the deleted label values start from zero again
+	c.Inc([]string{"a", "1"})
+	if got, _ := c.GetValue([]string{"a", "1"}); got != 1 {
+		t.Errorf("PBCounter.GetValue() = %v, want %v", got, 1)
+	}
+	c.Reset()
+	if got := len(c.LabelValues()); got != 0 {
+		t.Errorf("len(PBCounter.LabelValues()) = %d, want %d", got, 0)
+	}
+}
+
+func TestPBCounter_TryAddRejected(t *testing.T) {
+	c := NewPBCounter("test_total", "test", []string{"label1"}, WithMaxSeries(1))
+	if err := c.TryAdd([]string{"a"}, -1); !errors.Is(err, ErrNegativeValue) {
+		t.Errorf("PBCounter.TryAdd() error = %v, want %v", err, ErrNegativeValue)
+	}
+	for _, v := range []float64{math.NaN(), math.Inf(1)} {
+		if err := c.TryAdd([]string{"a"}, v); !errors.Is(err, ErrInvalidValue) {
+			t.Errorf("PBCounter.TryAdd(%v) error = %v, want %v", v, err, ErrInvalidValue)
+		}
+	}
+	// the rejected values create no series and take no slot of the limit
+	c.Inc([]string{"b"})
+	if got, want := c.LabelValues(), [][]string{{"b"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("PBCounter.LabelValues() = %v, want %v", got, want)
+	}
+}
+
+func TestPBCounter_DeleteRecreate(t *testing.T) {
+	c := NewPBCounter("test_total", "test", []string{"label1"}, WithStaleMarkers())
+	c.Inc([]string{"a"})
+	c.TimeSeries(1)
+
+	// the label values recreated before the next push is not stale
+	c.Delete([]string{"a"})
+	c.Inc([]string{"a"})
+	tsList := c.TimeSeries(2)
+	if len(tsList) != 1 {
+		t.Fatalf("len(PBCounter.TimeSeries()) = %d, want %d", len(tsList), 1)
+	}
+	if got := tsList[0].Samples; len(got) != 1 || got[0].Value != 1 {
+		t.Errorf("PBCounter.TimeSeries() %s = %v, want %v", seriesString(tsList[0]), got, 1)
+	}
+}
+
+func TestPBCounter_TTL(t *testing.T) {
+	now := time.Unix(1722838400, 0)
+	c := NewPBCounter("test", "test", []string{"label1"}, WithTTL(time.Minute))
+	c.vec.cfg.now = func() time.Time { return now }
+
+	c.Inc([]string{"a"})
+	c.Inc([]string{"b"})
+	now = now.Add(50 * time.Second)
+	c.Inc([]string{"b"})
+	if got := len(c.TimeSeries(1)); got != 2 {
+		t.Errorf("len(PBCounter.TimeSeries()) = %d, want %d", got, 2)
+	}
+
+	now = now.Add(20 * time.Second)
+	tsList := c.TimeSeries(2)
+	if len(tsList) != 2 {
+		t.Fatalf("len(PBCounter.TimeSeries()) = %d, want %d", len(tsList), 2)
+	}
+	for _, ts := range tsList {
+		if got, want := IsStaleNaN(ts.Samples[0].Value), ts.Labels[1].Value == "a"; got != want {
+			t.Errorf("PBCounter.TimeSeries() %s = %v", seriesString(ts), ts.Samples[0].Value)
+		}
+	}
+	if got := len(c.TimeSeries(3)); got != 1 {
+		t.Errorf("len(PBCounter.TimeSeries()) = %d, want %d", got, 1)
+	}
+}
+
+func TestPBCounter_MaxSeries(t *testing.T) {
+	c := NewPBCounter("test_max_series", "test", []string{"label1", "label2"}, WithMaxSeries(2))
+	c.Inc([]string{"a", "1"})
+	c.Inc([]string{"a", "2"})
+	c.Inc([]string{"a", "3"})
+	c.Inc([]string{"a", "4"})
+	c.Inc([]string{"a", "4"})
+	c.Inc([]string{"a", "1"})
+
+	want := map[string]float64{
+		`test_max_series{label1="a",label2="1"}`:                       2,
+		`test_max_series{label1="a",label2="2"}`:                       1,
+		`test_max_series{label1="__overflow__",label2="__overflow__"}`: 3,
+	}
+	got := map[string]float64{}
+	for _, ts := range c.TimeSeries(1) {
+		got[seriesString(ts)] = ts.Samples[0].Value
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PBCounter.TimeSeries() = %v, want %v", got, want)
+	}
+	// the distinct label values are counted, not the writes
+	if got := testutil.ToFloat64(SeriesOverflowCounter.WithLabelValues("test_max_series")); got != 2 {
+		t.Errorf("SeriesOverflowCounter = %v, want %v", got, 2)
+	}
+}
+
+func TestPBCounter_ConstLabels(t *testing.T) {
+	c := NewPBCounter("requests_total", "test", []string{"code"},
+		WithNamespace("app"), WithSubsystem("http"),
+		WithConstLabels(prometheus.Labels{"service": "api", "region": ""}))
+	c.Inc([]string{"200"})
+
+	if got, want := c.Name(), "app_http_requests_total"; got != want {
+		t.Errorf("PBCounter.Name() = %v, want %v", got, want)
+	}
+	want := map[string]float64{
+		`app_http_requests_total{code="200",service="api"}`: 1,
+	}
+	got := map[string]float64{}
+	for _, ts := range c.TimeSeries(1) {
+		got[seriesString(ts)] = ts.Samples[0].Value
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PBCounter.TimeSeries() = %v, want %v", got, want)
+	}
+
+	exp := `
+# HELP app_http_requests_total test
+# TYPE app_http_requests_total counter
+app_http_requests_total{code="200",region="",service="api"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(exp)); err != nil {
+		t.Errorf("PBCounter.Collect() %v", err)
+	}
+}
+
+func TestNewPBCounter_InvalidConstLabels(t *testing.T) {
+	tests := []struct {
+		name        string
+		constLabels prometheus.Labels
+	}{
+		{
+			name:        "duplicate variable label",
+			constLabels: prometheus.Labels{"code": "200"},
+		},
+		{
+			name:        "reserved label",
+			constLabels: prometheus.Labels{"__name__": "x"},
+		},
+		{
+			name:        "invalid utf8",
+			constLabels: prometheus.Labels{"service": "\xff"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewPBCounter() did not panic")
+				}
+			}()
+			NewPBCounter("requests_total", "test", []string{"code"}, WithConstLabels(tt.constLabels))
+		})
+	}
+}
+
+func TestPBCounter_Merge(t *testing.T) {
+	c := NewPBCounter("test_total", "test", []string{"label1"})
+	c.Add([]string{"a"}, 1)
+	other := NewPBCounter("test_total", "test", []string{"label1"})
+	other.Add([]string{"a"}, 2)
+	other.Add([]string{"b"}, 3)
+
+	if err := c.Merge(other); err != nil {
+		t.Fatalf("PBCounter.Merge() error = %v", err)
+	}
+	for lv, want := range map[string]float64{"a": 3, "b": 3} {
+		if got, err := c.GetValue([]string{lv}); err != nil || got != want {
+			t.Errorf("PBCounter.GetValue(%s) = %v, %v, want %v", lv, got, err, want)
+		}
+	}
+	if got, _ := other.GetValue([]string{"a"}); got != 2 {
+		t.Errorf("PBCounter.Merge() modified other, got %v, want %v", got, 2)
+	}
+
+	mismatch := NewPBCounter("test_total", "test", []string{"label2"})
+	if err := c.Merge(mismatch); !errors.Is(err, ErrMergeMismatch) {
+		t.Errorf("PBCounter.Merge() error = %v, want %v", err, ErrMergeMismatch)
+	}
+}
+
+func TestPBCounter_SetTotal(t *testing.T) {
+	now := time.Unix(100, 0)
+	c := NewPBCounter("test_total", "test", []string{"dev"}, WithCreatedSeries())
+	c.vec.cfg.now = func() time.Time { return now }
+
+	c.SetTotal([]string{"eth0"}, 10)
+	now = now.Add(time.Second)
+	c.SetTotal([]string{"eth0"}, 15)
+	if got, _ := c.GetValue([]string{"eth0"}); got != 15 {
+		t.Errorf("PBCounter.GetValue() = %v, want %v", got, 15)
+	}
+	if got, _ := c.Created([]string{"eth0"}); !got.Equal(time.Unix(100, 0)) {
+		t.Errorf("PBCounter.Created() = %v, want %v", got, time.Unix(100, 0))
+	}
+
+	// reset
+	now = now.Add(time.Second)
+	c.SetTotal([]string{"eth0"}, 3)
+	want := map[string]float64{
+		`test_total{dev="eth0"}`:   3,
+		`test_created{dev="eth0"}`: 102,
+	}
+	got := map[string]float64{}
+	for _, ts := range c.TimeSeries(1) {
+		got[seriesString(ts)] = ts.Samples[0].Value
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PBCounter.TimeSeries() = %v, want %v", got, want)
+	}
+
+	if err := c.TrySetTotal([]string{"eth0"}, -1); !errors.Is(err, ErrNegativeValue) {
+		t.Errorf("PBCounter.TrySetTotal() error = %v, want %v", err, ErrNegativeValue)
+	}
+	for _, total := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if err := c.TrySetTotal([]string{"eth0"}, total); !errors.Is(err, ErrInvalidValue) {
+			t.Errorf("PBCounter.TrySetTotal(%v) error = %v, want %v", total, err, ErrInvalidValue)
+		}
+	}
+	// the series is not poisoned
+	c.SetTotal([]string{"eth0"}, 9)
+	if got, _ := c.GetValue([]string{"eth0"}); got != 9 {
+		t.Errorf("PBCounter.GetValue() = %v, want %v", got, 9)
+	}
+}
+
+func TestPBCounter_SetTotalMaxSeries(t *testing.T) {
+	c := NewPBCounter("test_total", "test", []string{"dev"}, WithMaxSeries(1))
+	c.SetTotal([]string{"eth0"}, 10)
+	for i := 0; i < 3; i++ {
+		if err := c.TrySetTotal([]string{"eth1"}, 100); !errors.Is(err, ErrMaxSeries) {
+			t.Errorf("PBCounter.TrySetTotal() error = %v, want %v", err, ErrMaxSeries)
+		}
+	}
+	if got := c.LabelValues(); !reflect.DeepEqual(got, [][]string{{"eth0"}}) {
+		t.Errorf("PBCounter.LabelValues() = %v, want %v", got, [][]string{{"eth0"}})
+	}
+	if err := c.TrySetTotal([]string{"eth0"}, 20); err != nil {
+		t.Errorf("PBCounter.TrySetTotal() error = %v", err)
+	}
+}
+
+func TestPBCounter_CreatedZeroSamples(t *testing.T) {
+	now := time.UnixMilli(1000)
+	c := NewPBCounter("test_total", "test", []string{"dev"}, WithCreatedZeroSamples())
+	c.vec.cfg.now = func() time.Time { return now }
+
+	c.SetTotal([]string{"eth0"}, 10)
+	want := [][]float64{{0, 1000, 10, 2000}, {10, 3000}}
+	for i, ts := range []int64{2000, 3000} {
+		var got []float64
+		for _, smp := range c.TimeSeries(ts)[0].Samples {
+			got = append(got, smp.Value, float64(smp.Timestamp))
+		}
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("PBCounter.TimeSeries(%d) samples = %v, want %v", ts, got, want[i])
+		}
+	}
+
+	// a reset injects a zero sample again
+	now = time.UnixMilli(3500)
+	c.SetTotal([]string{"eth0"}, 1)
+	if got := c.TimeSeries(4000)[0].Samples; len(got) != 2 || got[0].Timestamp != 3500 {
+		t.Errorf("PBCounter.TimeSeries() after reset samples = %v, want a zero sample at %d", got, 3500)
+	}
+}
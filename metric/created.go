@@ -0,0 +1,52 @@
+package metric
+
+import (
+	"strings"
+
+	"github.com/sq325/remoteWrite/prompb"
+)
+
+// createdName returns the name of the created series of name, see WithCreatedSeries
+func createdName(name string) string {
+	return strings.TrimSuffix(name, "_total") + "_created"
+}
+
+// createdDesc returns the Desc of the created series of desc, a gauge whose value is the created timestamp in seconds,
+// so that Registry detects conflicts with it and Metadata describes it
+func createdDesc(desc *Desc) *Desc {
+	return &Desc{
+		Name:        createdName(desc.Name),
+		Help:        desc.Help + " (created timestamp in seconds)",
+		Type:        prompb.MetricMetadata_GAUGE,
+		Labels:      desc.Labels,
+		ConstLabels: desc.ConstLabels,
+	}
+}
+
+// createdTimeSeries generates the created series of a label values, see WithCreatedSeries
+// created: created timestamp in unix nano
+func createdTimeSeries(name string, labels, lvs []string, constLabels map[string]string, created int64, timestamp int64) *prompb.TimeSeries {
+	return &prompb.TimeSeries{
+		Labels: prompbLabels(createdName(name), labels, lvs, constLabels),
+		Samples: []*prompb.Sample{
+			{
+				Value:     float64(created) / 1e9,
+				Timestamp: timestamp,
+			},
+		},
+	}
+}
+
+// pushSamples returns the sample of value at timestamp,
+// preceded by a zero sample at the created timestamp if WithCreatedZeroSamples is set
+// and the label values is created after the last push.
+// created: created timestamp in unix nano
+// lastPush, timestamp: timestamp in ms
+func pushSamples(cfg *config, value float64, created int64, lastPush int64, timestamp int64) []*prompb.Sample {
+	sample := &prompb.Sample{Value: value, Timestamp: timestamp}
+	createdMs := created / 1e6
+	if !cfg.CreatedZeroSamples || createdMs <= lastPush || createdMs >= timestamp {
+		return []*prompb.Sample{sample}
+	}
+	return []*prompb.Sample{{Value: 0, Timestamp: createdMs}, sample}
+}
@@ -0,0 +1,239 @@
+package metric
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sq325/remoteWrite/prompb"
+)
+
+var ErrStaleProducer = errors.New("delta is from a previous run of the producer")
+
+// Producer identifies the source of deltas, e.g. a short-lived worker process
+type Producer struct {
+	ID    string    // empty ID means an anonymous producer, which is not tracked
+	Start time.Time // start time of the current run of the producer, a later Start means a restart
+}
+
+// producerTracker tracks the runs of producers to detect restarts and drop deltas of previous runs
+type producerTracker struct {
+	name string // metric name for logging
+	cfg  *config
+
+	mtx       sync.Mutex
+	producers map[string]*producerState // ID -> state
+}
+
+type producerState struct {
+	start time.Time
+	seen  time.Time
+}
+
+func newProducerTracker(name string, cfg *config) *producerTracker {
+	return &producerTracker{
+		name:      name,
+		cfg:       cfg,
+		producers: map[string]*producerState{},
+	}
+}
+
+// admit records p and returns ErrStaleProducer if p is a previous run of a known producer
+func (pt *producerTracker) admit(p Producer) error {
+	if p.ID == "" {
+		return nil
+	}
+
+	pt.mtx.Lock()
+	defer pt.mtx.Unlock()
+
+	now := pt.cfg.now()
+	ps, ok := pt.producers[p.ID]
+	switch {
+	case !ok:
+		pt.producers[p.ID] = &producerState{start: p.Start, seen: now}
+		return nil
+	case p.Start.Before(ps.start):
+		return fmt.Errorf("%w: producer %s started at %v, got delta of run started at %v", ErrStaleProducer, p.ID, ps.start, p.Start)
+	case p.Start.After(ps.start):
+		slog.Info("producer restart detected", "name", pt.name, "producer", p.ID, "start", p.Start, "previous", ps.start)
+		ps.start = p.Start
+	}
+	ps.seen = now
+	return nil
+}
+
+// expire forgets the producers not seen within TTL
+func (pt *producerTracker) expire() {
+	if pt.cfg.TTL <= 0 {
+		return
+	}
+	deadline := pt.cfg.now().Add(-pt.cfg.TTL)
+
+	pt.mtx.Lock()
+	defer pt.mtx.Unlock()
+
+	for id, ps := range pt.producers {
+		if ps.seen.Before(deadline) {
+			delete(pt.producers, id)
+		}
+	}
+}
+
+// DeltaCounter maintains a cumulative PBCounter from delta updates, e.g. "3 more errors since last report",
+// like the delta-to-cumulative processor of OpenTelemetry.
+// Deltas of a previous run of a producer are dropped, see Producer.
+// With WithTTL, producers not seen within TTL are forgotten, and label values not updated within TTL expire.
+// DeltaCounter implements PBDescriber and prometheus.Collector
+type DeltaCounter struct {
+	c  *PBCounter
+	pt *producerTracker
+}
+
+var (
+	_ PBDescriber          = (*DeltaCounter)(nil)
+	_ prometheus.Collector = (*DeltaCounter)(nil)
+)
+
+// NewDeltaCounter panics if name or labels are invalid, see ValidateDesc
+func NewDeltaCounter(name string, help string, labels []string, opts ...Option) *DeltaCounter {
+	c := NewPBCounter(name, help, labels, opts...)
+	return &DeltaCounter{
+		c:  c,
+		pt: newProducerTracker(c.Name(), c.vec.cfg),
+	}
+}
+
+// PBCounter returns the underlying cumulative PBCounter
+func (d *DeltaCounter) PBCounter() *PBCounter {
+	return d.c
+}
+
+// AddDelta adds delta reported by p to the label values.
+// Errors are logged, use TryAddDelta to handle them
+func (d *DeltaCounter) AddDelta(p Producer, lvs []string, delta float64) {
+	if err := d.TryAddDelta(p, lvs, delta); err != nil {
+		slog.Error("DeltaCounter.AddDelta failed", "name", d.c.Name(), "producer", p.ID, "labelvalues", lvs, "delta", delta, "err", err)
+	}
+}
+
+// TryAddDelta is like AddDelta but returns an error instead of logging it
+// It returns ErrStaleProducer, or the errors of PBCounter.TryAdd.
+func (d *DeltaCounter) TryAddDelta(p Producer, lvs []string, delta float64) error {
+	if err := d.pt.admit(p); err != nil {
+		return err
+	}
+	return d.c.TryAdd(lvs, delta)
+}
+
+// Implement PBMetric interface
+// timestamp: timestamp is in ms format
+func (d *DeltaCounter) TimeSeries(timestamp int64) []*prompb.TimeSeries {
+	d.pt.expire()
+	return d.c.TimeSeries(timestamp)
+}
+
+// Implement PBDescriber interface
+func (d *DeltaCounter) Descs() []*Desc {
+	return d.c.Descs()
+}
+
+// Implement prometheus.Collector interface
+func (d *DeltaCounter) Describe(ch chan<- *prometheus.Desc) {
+	d.c.Describe(ch)
+}
+
+// Implement prometheus.Collector interface
+func (d *DeltaCounter) Collect(ch chan<- prometheus.Metric) {
+	d.c.Collect(ch)
+}
+
+// DeltaHistogram maintains a cumulative PBHistogram from delta updates, see DeltaCounter
+// DeltaHistogram implements PBDescriber and prometheus.Collector
+type DeltaHistogram struct {
+	hg *PBHistogram
+	pt *producerTracker
+}
+
+var (
+	_ PBDescriber          = (*DeltaHistogram)(nil)
+	_ prometheus.Collector = (*DeltaHistogram)(nil)
+)
+
+// NewDeltaHistogram panics if name, labels or buckets are invalid, see NewPBHistogram
+func NewDeltaHistogram(name string, help string, labels []string, buckets []float64, opts ...Option) *DeltaHistogram {
+	hg := NewPBHistogram(name, help, labels, buckets, opts...)
+	return &DeltaHistogram{
+		hg: hg,
+		pt: newProducerTracker(hg.name, hg.cfg),
+	}
+}
+
+// PBHistogram returns the underlying cumulative PBHistogram
+func (d *DeltaHistogram) PBHistogram() *PBHistogram {
+	return d.hg
+}
+
+// AddDelta adds the observations reported by p to the label values.
+// counts are the number of observations in each bucket since the last report, not cumulative,
+// the last one is the +Inf bucket, so len(counts) is len(Buckets())+1. sum is the sum of the observations.
+// Errors are logged, use TryAddDelta to handle them
+func (d *DeltaHistogram) AddDelta(p Producer, lvs []string, counts []float64, sum float64) {
+	if err := d.TryAddDelta(p, lvs, counts, sum); err != nil {
+		slog.Error("DeltaHistogram.AddDelta failed", "name", d.hg.name, "producer", p.ID, "labelvalues", lvs, "err", err)
+	}
+}
+
+// TryAddDelta is like AddDelta but returns an error instead of logging it
+// It returns ErrStaleProducer, ErrInvalidBuckets if len(counts) mismatches, ErrNegativeValue if a count is negative,
+// ErrInvalidValue if a count or sum is NaN or infinite, or the errors of PBHistogram.TryObserve.
+func (d *DeltaHistogram) TryAddDelta(p Producer, lvs []string, counts []float64, sum float64) error {
+	if len(counts) != len(d.hg.buckets)+1 {
+		return fmt.Errorf("%w: %s has %d buckets including +Inf, got %d counts",
+			ErrInvalidBuckets, d.hg.name, len(d.hg.buckets)+1, len(counts))
+	}
+	cumulative := make([]float64, len(d.hg.buckets))
+	var n float64
+	for i, c := range counts {
+		if err := checkCounterValue(c); err != nil {
+			return fmt.Errorf("count of bucket %d: %w", i, err)
+		}
+		n += c
+		if i < len(cumulative) {
+			cumulative[i] = n
+		}
+	}
+	if math.IsNaN(sum) || math.IsInf(sum, 0) {
+		return fmt.Errorf("%w: sum %v", ErrInvalidValue, sum)
+	}
+	if err := d.pt.admit(p); err != nil {
+		return err
+	}
+	return d.hg.observe(lvs, cumulative, n, sum)
+}
+
+// Implement PBMetric interface
+// timestamp: timestamp is in ms format
+func (d *DeltaHistogram) TimeSeries(timestamp int64) []*prompb.TimeSeries {
+	d.pt.expire()
+	return d.hg.TimeSeries(timestamp)
+}
+
+// Implement PBDescriber interface
+func (d *DeltaHistogram) Descs() []*Desc {
+	return d.hg.Descs()
+}
+
+// Implement prometheus.Collector interface
+func (d *DeltaHistogram) Describe(ch chan<- *prometheus.Desc) {
+	d.hg.Describe(ch)
+}
+
+// Implement prometheus.Collector interface
+func (d *DeltaHistogram) Collect(ch chan<- prometheus.Metric) {
+	d.hg.Collect(ch)
+}
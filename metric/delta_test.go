@@ -0,0 +1,75 @@
+package metric
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDeltaCounter(t *testing.T) {
+	now := time.Unix(100, 0)
+	d := NewDeltaCounter("errors_total", "test", []string{"kind"}, WithTTL(time.Minute))
+	d.c.vec.cfg.now = func() time.Time { return now }
+
+	run1 := Producer{ID: "worker-1", Start: time.Unix(10, 0)}
+	run2 := Producer{ID: "worker-1", Start: time.Unix(90, 0)}
+	d.AddDelta(run1, []string{"io"}, 3)
+	d.AddDelta(Producer{}, []string{"io"}, 1)
+	d.AddDelta(run2, []string{"io"}, 2) // restart, deltas keep accumulating
+	if err := d.TryAddDelta(run1, []string{"io"}, 5); !errors.Is(err, ErrStaleProducer) {
+		t.Errorf("DeltaCounter.TryAddDelta() error = %v, want %v", err, ErrStaleProducer)
+	}
+	if got, _ := d.PBCounter().GetValue([]string{"io"}); got != 6 {
+		t.Errorf("PBCounter.GetValue() = %v, want %v", got, 6)
+	}
+
+	// the inactive producer and label values expire
+	now = now.Add(2 * time.Minute)
+	for _, ts := range d.TimeSeries(1) {
+		if !IsStaleNaN(ts.Samples[0].Value) {
+			t.Errorf("DeltaCounter.TimeSeries() %s = %v, want staleness marker", seriesString(ts), ts.Samples[0].Value)
+		}
+	}
+	if err := d.TryAddDelta(run1, []string{"io"}, 1); err != nil {
+		t.Errorf("DeltaCounter.TryAddDelta() of expired producer error = %v", err)
+	}
+}
+
+func TestDeltaHistogram(t *testing.T) {
+	d := NewDeltaHistogram("latency", "test", nil, []float64{1, 2})
+	p := Producer{ID: "worker-1", Start: time.Unix(10, 0)}
+	d.AddDelta(p, nil, []float64{1, 2, 1}, 5)
+	d.AddDelta(p, nil, []float64{0, 1, 0}, 1.5)
+
+	s, err := d.PBHistogram().Snapshot(nil)
+	if err != nil {
+		t.Fatalf("PBHistogram.Snapshot() error = %v", err)
+	}
+	want := &HistogramSnapshot{
+		Buckets: []Bucket{{1, 1}, {2, 4}, {math.Inf(1), 5}},
+		Count:   5,
+		Sum:     6.5,
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("PBHistogram.Snapshot() = %+v, want %+v", s, want)
+	}
+
+	if err := d.TryAddDelta(p, nil, []float64{1, 2}, 1); !errors.Is(err, ErrInvalidBuckets) {
+		t.Errorf("DeltaHistogram.TryAddDelta() error = %v, want %v", err, ErrInvalidBuckets)
+	}
+	if err := d.TryAddDelta(p, nil, []float64{1, -1, 0}, 1); !errors.Is(err, ErrNegativeValue) {
+		t.Errorf("DeltaHistogram.TryAddDelta() error = %v, want %v", err, ErrNegativeValue)
+	}
+	if err := d.TryAddDelta(p, nil, []float64{math.NaN(), 1, 0}, 1); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("DeltaHistogram.TryAddDelta() error = %v, want %v", err, ErrInvalidValue)
+	}
+	if err := d.TryAddDelta(p, nil, []float64{0, 1, 0}, math.Inf(1)); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("DeltaHistogram.TryAddDelta() error = %v, want %v", err, ErrInvalidValue)
+	}
+	// the rejected deltas are not added
+	if s, _ := d.PBHistogram().Snapshot(nil); s.Count != 5 || s.Sum != 6.5 {
+		t.Errorf("PBHistogram.Snapshot() after rejected deltas = %+v", s)
+	}
+}
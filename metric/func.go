@@ -0,0 +1,214 @@
+package metric
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sq325/remoteWrite/prompb"
+)
+
+// FuncSample is a value of a label values returned by the callback of a FuncMetric
+type FuncSample struct {
+	LabelValues []string
+	Value       float64
+}
+
+// FuncMetric is a counter or gauge whose values are read by a callback when TimeSeries or Collect is called,
+// e.g. cache sizes and connection pool stats.
+// The callback is called once per TimeSeries call and once per Collect call, they do not share the result,
+// so the callback is called twice if the FuncMetric is both pushed and scraped.
+// The callback must be safe for concurrent use.
+// FuncMetric implements PBDescriber and prometheus.Collector
+type FuncMetric struct {
+	name   string
+	help   string
+	typ    prompb.MetricMetadata_MetricType
+	labels []string
+	fn     func() []FuncSample
+	desc   *prometheus.Desc // used by Collect
+	cfg    *config
+
+	mtx  sync.Mutex
+	last map[string][]string // label values of the last TimeSeries call, only maintained if WithStaleMarkers is set
+}
+
+var (
+	_ PBDescriber          = (*FuncMetric)(nil)
+	_ prometheus.Collector = (*FuncMetric)(nil)
+)
+
+// NewCounterFunc creates a counter without variable labels whose value is f(), use WithConstLabels for a fixed label set.
+// f must return a monotonic value.
+// NewCounterFunc panics if name is invalid, see ValidateDesc
+func NewCounterFunc(name string, help string, f func() float64, opts ...Option) *FuncMetric {
+	return newFuncMetric(name, help, prompb.MetricMetadata_COUNTER, nil, singleSample(f), opts...)
+}
+
+// NewGaugeFunc creates a gauge without variable labels whose value is f(), use WithConstLabels for a fixed label set.
+// NewGaugeFunc panics if name is invalid, see ValidateDesc
+func NewGaugeFunc(name string, help string, f func() float64, opts ...Option) *FuncMetric {
+	return newFuncMetric(name, help, prompb.MetricMetadata_GAUGE, nil, singleSample(f), opts...)
+}
+
+// NewCounterVecFunc creates a counter whose label values and values are returned by f.
+// The label values of each FuncSample must match labels, and must be unique.
+// NewCounterVecFunc panics if name or labels are invalid, see ValidateDesc
+func NewCounterVecFunc(name string, help string, labels []string, f func() []FuncSample, opts ...Option) *FuncMetric {
+	return newFuncMetric(name, help, prompb.MetricMetadata_COUNTER, labels, f, opts...)
+}
+
+// NewGaugeVecFunc creates a gauge whose label values and values are returned by f, see NewCounterVecFunc
+func NewGaugeVecFunc(name string, help string, labels []string, f func() []FuncSample, opts ...Option) *FuncMetric {
+	return newFuncMetric(name, help, prompb.MetricMetadata_GAUGE, labels, f, opts...)
+}
+
+func singleSample(f func() float64) func() []FuncSample {
+	return func() []FuncSample {
+		return []FuncSample{{Value: f()}}
+	}
+}
+
+func newFuncMetric(name, help string, typ prompb.MetricMetadata_MetricType, labels []string, f func() []FuncSample, opts ...Option) *FuncMetric {
+	cfg := newConfig(opts...)
+	fqName := cfg.fqName(name)
+	if err := validateDescWithConstLabels(fqName, labels, cfg.ConstLabels); err != nil {
+		panic(err)
+	}
+	return &FuncMetric{
+		name:   fqName,
+		help:   help,
+		typ:    typ,
+		labels: labels,
+		fn:     f,
+		desc:   prometheus.NewDesc(fqName, help, labels, cfg.ConstLabels),
+		cfg:    cfg,
+	}
+}
+
+// Name return the name of metric
+func (fm *FuncMetric) Name() string {
+	return fm.name
+}
+
+// Labels not include __name__
+func (fm *FuncMetric) Labels() []string {
+	return fm.labels
+}
+
+// samples calls the callback, the invalid samples are logged and dropped,
+// the duplicate label values are logged and the last sample wins
+func (fm *FuncMetric) samples() []FuncSample {
+	samples := fm.fn()
+	valid := make([]FuncSample, 0, len(samples))
+	index := make(map[string]int, len(samples)) // label values -> index in valid
+	for _, smp := range samples {
+		if err := fm.validate(smp); err != nil {
+			slog.Error("invalid sample of FuncMetric, dropped", "name", fm.name, "labelvalues", smp.LabelValues, "value", smp.Value, "err", err)
+			continue
+		}
+		key := strings.Join(smp.LabelValues, "\xff")
+		if i, ok := index[key]; ok {
+			slog.Error("duplicate label values of FuncMetric, the last sample wins", "name", fm.name, "labelvalues", smp.LabelValues, "value", smp.Value)
+			valid[i] = smp
+			continue
+		}
+		index[key] = len(valid)
+		valid = append(valid, smp)
+	}
+	return valid
+}
+
+func (fm *FuncMetric) validate(smp FuncSample) error {
+	if len(smp.LabelValues) != len(fm.labels) {
+		return fmt.Errorf("%w: %s has %d labels %v, got %d label values %q",
+			ErrLabelValuesMismatch, fm.name, len(fm.labels), fm.labels, len(smp.LabelValues), smp.LabelValues)
+	}
+	for i, lv := range smp.LabelValues {
+		if !utf8.ValidString(lv) {
+			return fmt.Errorf("%w: label %s of %s has value %q", ErrInvalidUTF8, fm.labels[i], fm.name, lv)
+		}
+	}
+	if fm.typ == prompb.MetricMetadata_COUNTER && smp.Value < 0 {
+		return fmt.Errorf("%w: %v", ErrNegativeValue, smp.Value)
+	}
+	return nil
+}
+
+// Implement PBMetric interface
+// The callback is called once, and a staleness marker is generated for each label values
+// returned by the last call but not this one if WithStaleMarkers is set.
+// timestamp: timestamp is in ms format
+func (fm *FuncMetric) TimeSeries(timestamp int64) []*prompb.TimeSeries {
+	samples := fm.samples()
+
+	tsList := make([]*prompb.TimeSeries, 0, len(samples))
+	for _, smp := range samples {
+		tsList = append(tsList, &prompb.TimeSeries{
+			Labels: prompbLabels(fm.name, fm.labels, smp.LabelValues, fm.cfg.ConstLabels),
+			Samples: []*prompb.Sample{
+				{
+					Value:     smp.Value,
+					Timestamp: timestamp,
+				},
+			},
+		})
+	}
+	if !fm.cfg.StaleMarkers {
+		return tsList
+	}
+
+	fm.mtx.Lock()
+	defer fm.mtx.Unlock()
+
+	current := make(map[string][]string, len(samples))
+	for _, smp := range samples {
+		current[strings.Join(smp.LabelValues, "\xff")] = smp.LabelValues
+	}
+	for key, lvs := range fm.last {
+		if _, ok := current[key]; !ok {
+			tsList = append(tsList, staleTimeSeries(fm.name, fm.labels, lvs, fm.cfg.ConstLabels, timestamp))
+		}
+	}
+	fm.last = current
+	return tsList
+}
+
+// Implement PBDescriber interface
+func (fm *FuncMetric) Descs() []*Desc {
+	return []*Desc{
+		{
+			Name:   fm.name,
+			Help:   fm.help,
+			Type:   fm.typ,
+			Labels: fm.labels,
+
+			ConstLabels: fm.cfg.ConstLabels,
+		},
+	}
+}
+
+// Implement prometheus.Collector interface
+func (fm *FuncMetric) Describe(ch chan<- *prometheus.Desc) {
+	ch <- fm.desc
+}
+
+// Implement prometheus.Collector interface
+// The callback is called once, and a const metric is generated for each label values
+func (fm *FuncMetric) Collect(ch chan<- prometheus.Metric) {
+	vt := prometheus.GaugeValue
+	if fm.typ == prompb.MetricMetadata_COUNTER {
+		vt = prometheus.CounterValue
+	}
+	for _, smp := range fm.samples() {
+		m, err := prometheus.NewConstMetric(fm.desc, vt, smp.Value, smp.LabelValues...)
+		if err != nil {
+			slog.Error("NewConstMetric failed", "name", fm.name, "err", err)
+			continue
+		}
+		ch <- m
+	}
+}
@@ -0,0 +1,64 @@
+package metric
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestFuncMetric(t *testing.T) {
+	size := 3.0
+	g := NewGaugeFunc("cache_size", "test", func() float64 { return size }, WithConstLabels(prometheus.Labels{"cache": "users"}))
+
+	pools := []FuncSample{
+		{LabelValues: []string{"db"}, Value: 10},
+		{LabelValues: []string{"redis"}, Value: 5},
+		{LabelValues: []string{"a", "b"}, Value: 1}, // invalid, dropped
+		{LabelValues: []string{"mq"}, Value: -1},    // negative counter, dropped
+		{LabelValues: []string{"redis"}, Value: 6},  // duplicate, the last wins
+	}
+	c := NewCounterVecFunc("pool_connections_total", "test", []string{"pool"}, func() []FuncSample { return pools }, WithStaleMarkers())
+
+	want := map[string]float64{
+		`cache_size{cache="users"}`:            3,
+		`pool_connections_total{pool="db"}`:    10,
+		`pool_connections_total{pool="redis"}`: 6,
+	}
+	got := map[string]float64{}
+	for _, m := range []PBMetric{g, c} {
+		tsList := m.TimeSeries(1)
+		if m == c && len(tsList) != 2 {
+			t.Errorf("FuncMetric.TimeSeries() = %d series, want %d", len(tsList), 2)
+		}
+		for _, ts := range tsList {
+			got[seriesString(ts)] = ts.Samples[0].Value
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FuncMetric.TimeSeries() = %v, want %v", got, want)
+	}
+
+	pools = pools[:1]
+	var stale []string
+	for _, ts := range c.TimeSeries(2) {
+		if IsStaleNaN(ts.Samples[0].Value) {
+			stale = append(stale, seriesString(ts))
+		}
+	}
+	if want := []string{`pool_connections_total{pool="redis"}`}; !reflect.DeepEqual(stale, want) {
+		t.Errorf("FuncMetric.TimeSeries() staleness markers = %v, want %v", stale, want)
+	}
+
+	size = 4
+	exp := `
+# HELP cache_size test
+# TYPE cache_size gauge
+cache_size{cache="users"} 4
+`
+	if err := testutil.CollectAndCompare(g, strings.NewReader(exp)); err != nil {
+		t.Errorf("FuncMetric.Collect() %v", err)
+	}
+}
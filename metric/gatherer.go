@@ -0,0 +1,269 @@
+package metric
+
+import (
+	"log/slog"
+	"math"
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+	"github.com/sq325/remoteWrite/prompb"
+)
+
+const (
+	quantile_label = "quantile"
+)
+
+// GathererMetric adapts a prometheus.Gatherer to PBMetric,
+// so the metrics registered with client_golang can be pushed by remote write.
+// GathererMetric implements PBMetric
+type GathererMetric struct {
+	g prometheus.Gatherer
+
+	mtx sync.Mutex
+	mds []*prompb.MetricMetadata // metadata of the last gather, nil before the first gather
+}
+
+var _ PBMetric = (*GathererMetric)(nil)
+
+// e.g. NewGathererMetric(prometheus.DefaultGatherer)
+func NewGathererMetric(g prometheus.Gatherer) *GathererMetric {
+	return &GathererMetric{g: g}
+}
+
+// Implement PBMetric interface
+// timestamp: timestamp is in ms format, it is used if the metric has no timestamp of its own
+func (gm *GathererMetric) TimeSeries(timestamp int64) []*prompb.TimeSeries {
+	tsList, mds, err := GatherTimeSeries(gm.g, timestamp)
+	if err != nil {
+		slog.Error("Gather failed", "err", err)
+	}
+
+	gm.mtx.Lock()
+	gm.mds = mds
+	gm.mtx.Unlock()
+	return tsList
+}
+
+// Metadata returns the MetricMetadata of the metric families gathered by the last TimeSeries call,
+// so that the metadata describes the pushed series.
+// The Gatherer is gathered if TimeSeries is not called yet.
+func (gm *GathererMetric) Metadata() []*prompb.MetricMetadata {
+	gm.mtx.Lock()
+	defer gm.mtx.Unlock()
+
+	if gm.mds == nil {
+		mfs, err := gm.g.Gather()
+		if err != nil {
+			slog.Error("Gather failed", "err", err)
+		}
+		_, gm.mds = FromMetricFamilies(mfs, 0)
+	}
+	return gm.mds
+}
+
+// GatherTimeSeries gathers g and converts the result to TimeSeries and MetricMetadata.
+// As prometheus.Gatherer, the returned TimeSeries may be not empty even if err is not nil.
+func GatherTimeSeries(g prometheus.Gatherer, timestamp int64) ([]*prompb.TimeSeries, []*prompb.MetricMetadata, error) {
+	mfs, err := g.Gather()
+	tsList, mds := FromMetricFamilies(mfs, timestamp)
+	return tsList, mds, err
+}
+
+// FromMetricFamilies converts the output of prometheus.Gatherer to TimeSeries and MetricMetadata.
+// Supported types are counter, gauge, summary, classic histogram, native histogram and untyped.
+// A histogram with both classic buckets and native buckets generates both representations,
+// the native histogram of a gauge histogram has the GAUGE reset hint.
+// timestamp: timestamp is in ms format, it is used if the metric has no timestamp of its own
+func FromMetricFamilies(mfs []*dto.MetricFamily, timestamp int64) ([]*prompb.TimeSeries, []*prompb.MetricMetadata) {
+	var (
+		tsList = make([]*prompb.TimeSeries, 0, len(mfs))
+		mds    = make([]*prompb.MetricMetadata, 0, len(mfs))
+	)
+
+	for _, mf := range mfs {
+		name := mf.GetName()
+		mds = append(mds, &prompb.MetricMetadata{
+			Type:             metadataType(mf.GetType()),
+			MetricFamilyName: name,
+			Help:             mf.GetHelp(),
+		})
+
+		for _, m := range mf.GetMetric() {
+			t := timestamp
+			if m.TimestampMs != nil {
+				t = m.GetTimestampMs()
+			}
+			sample := func(name string, v float64, extra ...*prompb.Label) *prompb.TimeSeries {
+				return &prompb.TimeSeries{
+					Labels:  dtoLabels(name, m.GetLabel(), extra...),
+					Samples: []*prompb.Sample{{Value: v, Timestamp: t}},
+				}
+			}
+
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				tsList = append(tsList, sample(name, m.GetCounter().GetValue()))
+			case dto.MetricType_GAUGE:
+				tsList = append(tsList, sample(name, m.GetGauge().GetValue()))
+			case dto.MetricType_UNTYPED:
+				tsList = append(tsList, sample(name, m.GetUntyped().GetValue()))
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					tsList = append(tsList, sample(name, q.GetValue(), &prompb.Label{
+						Name:  quantile_label,
+						Value: formatFloat(q.GetQuantile()),
+					}))
+				}
+				tsList = append(tsList,
+					sample(name+"_sum", s.GetSampleSum()),
+					sample(name+"_count", float64(s.GetSampleCount())),
+				)
+			case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+				h := m.GetHistogram()
+				if isNativeHistogram(h) {
+					tsList = append(tsList, &prompb.TimeSeries{
+						Labels:     dtoLabels(name, m.GetLabel()),
+						Histograms: []*prompb.Histogram{nativeHistogram(h, resetHint(mf.GetType()), t)},
+					})
+				}
+				if len(h.GetBucket()) == 0 && isNativeHistogram(h) {
+					continue
+				}
+
+				count := float64(h.GetSampleCount())
+				if h.GetSampleCountFloat() > 0 {
+					count = h.GetSampleCountFloat()
+				}
+				var hasInf bool
+				for _, b := range h.GetBucket() {
+					v := float64(b.GetCumulativeCount())
+					if b.GetCumulativeCountFloat() > 0 {
+						v = b.GetCumulativeCountFloat()
+					}
+					if math.IsInf(b.GetUpperBound(), 1) {
+						hasInf = true
+					}
+					tsList = append(tsList, sample(name+"_bucket", v, &prompb.Label{
+						Name:  bucket_label,
+						Value: formatFloat(b.GetUpperBound()),
+					}))
+				}
+				if !hasInf {
+					tsList = append(tsList, sample(name+"_bucket", count, &prompb.Label{
+						Name:  bucket_label,
+						Value: formatFloat(math.Inf(1)),
+					}))
+				}
+				tsList = append(tsList,
+					sample(name+"_sum", h.GetSampleSum()),
+					sample(name+"_count", count),
+				)
+			default:
+				slog.Error("unsupported metric type", "name", name, "type", mf.GetType())
+			}
+		}
+	}
+
+	return tsList, mds
+}
+
+// dtoLabels generates []*prompb.Label based on the label pairs, adds the name label and extra labels
+// Labels are sorted by name, labels with empty value are dropped
+func dtoLabels(name string, pairs []*dto.LabelPair, extra ...*prompb.Label) []*prompb.Label {
+	labels := make([]*prompb.Label, 0, len(pairs)+len(extra)+1) // +1 for __name__
+	labels = append(labels, &prompb.Label{
+		Name:  model.MetricNameLabel,
+		Value: name,
+	})
+	for _, lp := range pairs {
+		if lp.GetValue() == "" {
+			continue
+		}
+		labels = append(labels, &prompb.Label{
+			Name:  lp.GetName(),
+			Value: lp.GetValue(),
+		})
+	}
+	labels = append(labels, extra...)
+
+	sortLabels(labels)
+	return labels
+}
+
+// isNativeHistogram reports whether h has native buckets, same as client_golang
+func isNativeHistogram(h *dto.Histogram) bool {
+	return h.GetZeroThreshold() > 0 || h.GetZeroCount() > 0 || h.GetZeroCountFloat() > 0 ||
+		len(h.GetPositiveSpan()) > 0 || len(h.GetNegativeSpan()) > 0
+}
+
+// resetHint returns the reset hint of the native histogram of type t,
+// counter resets of a histogram are unknown and detected by the receiver
+func resetHint(t dto.MetricType) prompb.Histogram_ResetHint {
+	if t == dto.MetricType_GAUGE_HISTOGRAM {
+		return prompb.Histogram_GAUGE
+	}
+	return prompb.Histogram_UNKNOWN
+}
+
+func nativeHistogram(h *dto.Histogram, hint prompb.Histogram_ResetHint, timestamp int64) *prompb.Histogram {
+	ph := &prompb.Histogram{
+		Sum:            h.GetSampleSum(),
+		Schema:         h.GetSchema(),
+		ZeroThreshold:  h.GetZeroThreshold(),
+		NegativeSpans:  bucketSpans(h.GetNegativeSpan()),
+		NegativeDeltas: h.GetNegativeDelta(),
+		NegativeCounts: h.GetNegativeCount(),
+		PositiveSpans:  bucketSpans(h.GetPositiveSpan()),
+		PositiveDeltas: h.GetPositiveDelta(),
+		PositiveCounts: h.GetPositiveCount(),
+		ResetHint:      hint,
+		Timestamp:      timestamp,
+	}
+	if h.GetSampleCountFloat() > 0 {
+		ph.Count = &prompb.Histogram_CountFloat{CountFloat: h.GetSampleCountFloat()}
+		ph.ZeroCount = &prompb.Histogram_ZeroCountFloat{ZeroCountFloat: h.GetZeroCountFloat()}
+	} else {
+		ph.Count = &prompb.Histogram_CountInt{CountInt: h.GetSampleCount()}
+		ph.ZeroCount = &prompb.Histogram_ZeroCountInt{ZeroCountInt: h.GetZeroCount()}
+	}
+	return ph
+}
+
+func bucketSpans(spans []*dto.BucketSpan) []*prompb.BucketSpan {
+	if len(spans) == 0 {
+		return nil
+	}
+	pbspans := make([]*prompb.BucketSpan, 0, len(spans))
+	for _, s := range spans {
+		pbspans = append(pbspans, &prompb.BucketSpan{
+			Offset: s.GetOffset(),
+			Length: s.GetLength(),
+		})
+	}
+	return pbspans
+}
+
+func metadataType(t dto.MetricType) prompb.MetricMetadata_MetricType {
+	switch t {
+	case dto.MetricType_COUNTER:
+		return prompb.MetricMetadata_COUNTER
+	case dto.MetricType_GAUGE:
+		return prompb.MetricMetadata_GAUGE
+	case dto.MetricType_SUMMARY:
+		return prompb.MetricMetadata_SUMMARY
+	case dto.MetricType_HISTOGRAM:
+		return prompb.MetricMetadata_HISTOGRAM
+	case dto.MetricType_GAUGE_HISTOGRAM:
+		return prompb.MetricMetadata_GAUGEHISTOGRAM
+	default:
+		return prompb.MetricMetadata_UNKNOWN
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,134 @@
+package metric
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sq325/remoteWrite/prompb"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestFromMetricFamilies(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_total", Help: "test"}, []string{"label1"})
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_gauge", Help: "test"})
+	summary := prometheus.NewSummary(prometheus.SummaryOpts{Name: "test_summary", Help: "test", Objectives: map[float64]float64{0.5: 0.05}})
+	hg := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_histogram", Help: "test", Buckets: []float64{1, 2}})
+	native := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_native", Help: "test", NativeHistogramBucketFactor: 1.1})
+	reg.MustRegister(counter, gauge, summary, hg, native)
+
+	counter.WithLabelValues("value1").Add(3)
+	gauge.Set(-2)
+	summary.Observe(4)
+	hg.Observe(1.5)
+	native.Observe(1.5)
+
+	tsList, mds, err := GatherTimeSeries(reg, 1722838400634)
+	if err != nil {
+		t.Fatalf("GatherTimeSeries() error = %v", err)
+	}
+	if len(mds) != 5 {
+		t.Errorf("len(metadata) = %d, want %d", len(mds), 5)
+	}
+
+	want := map[string]float64{
+		`test_total{label1="value1"}`:      3,
+		`test_gauge{}`:                     -2,
+		`test_summary{quantile="0.5"}`:     4,
+		`test_summary_sum{}`:               4,
+		`test_summary_count{}`:             1,
+		`test_histogram_bucket{le="1"}`:    0,
+		`test_histogram_bucket{le="2"}`:    1,
+		`test_histogram_bucket{le="+Inf"}`: 1,
+		`test_histogram_sum{}`:             1.5,
+		`test_histogram_count{}`:           1,
+		`test_native{}`:                    math.NaN(), // native histogram
+	}
+	got := map[string]*prompb.TimeSeries{}
+	for _, ts := range tsList {
+		got[seriesString(ts)] = ts
+	}
+	if len(got) != len(want) {
+		t.Errorf("len(TimeSeries) = %d, want %d", len(got), len(want))
+	}
+	for k, v := range want {
+		ts, ok := got[k]
+		if !ok {
+			t.Errorf("series %s not found", k)
+			continue
+		}
+		if math.IsNaN(v) {
+			if len(ts.Histograms) != 1 || ts.Histograms[0].GetCountInt() != 1 || ts.Histograms[0].Schema != 3 {
+				t.Errorf("series %s histograms = %v", k, ts.Histograms)
+			}
+			continue
+		}
+		if len(ts.Samples) != 1 || ts.Samples[0].Value != v || ts.Samples[0].Timestamp != 1722838400634 {
+			t.Errorf("series %s samples = %v, want %v", k, ts.Samples, v)
+		}
+	}
+}
+
+func TestFromMetricFamilies_GaugeHistogram(t *testing.T) {
+	mfs := []*dto.MetricFamily{
+		{
+			Name: proto.String("test_gauge_histogram"),
+			Type: dto.MetricType_GAUGE_HISTOGRAM.Enum(),
+			Metric: []*dto.Metric{{
+				Histogram: &dto.Histogram{
+					SampleCount:   proto.Uint64(1),
+					SampleSum:     proto.Float64(1.5),
+					Schema:        proto.Int32(0),
+					ZeroThreshold: proto.Float64(1e-128),
+					PositiveSpan:  []*dto.BucketSpan{{Offset: proto.Int32(1), Length: proto.Uint32(1)}},
+					PositiveDelta: []int64{1},
+				},
+			}},
+		},
+	}
+	tsList, _ := FromMetricFamilies(mfs, 1)
+	if len(tsList) != 1 || len(tsList[0].Histograms) != 1 {
+		t.Fatalf("FromMetricFamilies() = %v", tsList)
+	}
+	if got := tsList[0].Histograms[0].ResetHint; got != prompb.Histogram_GAUGE {
+		t.Errorf("FromMetricFamilies() reset hint = %v, want %v", got, prompb.Histogram_GAUGE)
+	}
+}
+
+func TestGathererMetric_Metadata(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_gauge", Help: "test"}))
+	gm := NewGathererMetric(reg)
+	gm.TimeSeries(1)
+
+	// the metadata describes the last gather
+	reg.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_gauge2", Help: "test"}))
+	if got := len(gm.Metadata()); got != 1 {
+		t.Errorf("len(GathererMetric.Metadata()) = %d, want %d", got, 1)
+	}
+	gm.TimeSeries(2)
+	if got := len(gm.Metadata()); got != 2 {
+		t.Errorf("len(GathererMetric.Metadata()) = %d, want %d", got, 2)
+	}
+}
+
+// seriesString formats ts as name{label="value",...} with labels sorted by name
+func seriesString(ts *prompb.TimeSeries) string {
+	var (
+		name string
+		kv   []string
+	)
+	for _, l := range ts.Labels {
+		if l.Name == "__name__" {
+			name = l.Value
+			continue
+		}
+		kv = append(kv, l.Name+`="`+l.Value+`"`)
+	}
+	sort.Strings(kv)
+	return name + "{" + strings.Join(kv, ",") + "}"
+}
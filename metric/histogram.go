@@ -1,12 +1,18 @@
 package metric
 
 import (
+	"fmt"
 	"log/slog"
 	"math"
 	"slices"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
 	"github.com/sq325/remoteWrite/prompb"
 )
 
@@ -15,7 +21,15 @@ const (
 )
 
 var (
-	defaultBuckets = []float64{25, 50, 75, 100, 200, 500, 1000, math.Inf(1)}
+	// HistogramRepairCounter counts the label values of a PBHistogram whose buckets were found not cumulative by TimeSeries,
+	// each is counted once until found cumulative again, register it with RegisterInternalMetrics
+	HistogramRepairCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "remotewrite_histogram_repaired_total",
+			Help: "Total number of times the buckets of a histogram series became not cumulative and were repaired",
+		},
+		[]string{"name"},
+	)
 )
 
 type HistogramMeter interface {
@@ -43,74 +57,87 @@ type HistogramReader interface {
 // labelValues should all have the same value except for 'le'
 // PBHistogram implements HistogramMeter
 type PBHistogram struct {
+	name    string // name without _bucket suffix
+	help    string
 	vec     *Vec      // bucket_label must be included in end of labels
-	buckets []float64 // must sorted by ascending
+	buckets []float64 // sorted by ascending, not include +Inf
 	count   *Vec
 	sum     *Vec
+	desc    *prometheus.Desc // used by Collect
+	cfg     *config
+
+	// writes hold the read lock, and readers and deletes hold the write lock,
+	// so that the buckets, count and sum of an observation are seen and deleted together,
+	// and a series is not expired by a stale update time while being written
+	mtx sync.RWMutex
+
+	lastPush atomic.Int64 // timestamp in ms of the last TimeSeries call, see WithCreatedZeroSamples
+
+	repairMtx sync.Mutex
+	repaired  map[string]struct{} // label values found not cumulative by the last TimeSeries call, see reportRepairs
 }
 
-var _ HistogramMeter = (*PBHistogram)(nil)
+var (
+	_ HistogramMeter       = (*PBHistogram)(nil)
+	_ PBDescriber          = (*PBHistogram)(nil)
+	_ prometheus.Collector = (*PBHistogram)(nil)
+)
 
-// name is the name of histogram without _bucket suffix
+// name is the name of histogram without _bucket suffix, it is prefixed by WithNamespace and WithSubsystem
 // labels must not include bucket_label le
-func NewPBHistogram(name string, help string, labels []string, buckets []float64) *PBHistogram {
+// buckets are the upper bounds in ascending order, +Inf is optional, DefaultBuckets are used if empty,
+// see LinearBuckets, ExponentialBuckets and ExponentialBucketsRange
+// NewPBHistogram panics if name or labels are invalid, see ValidateDesc, or buckets are invalid, see ErrInvalidBuckets
+func NewPBHistogram(name string, help string, labels []string, buckets []float64, opts ...Option) *PBHistogram {
+	cfg := newConfig(opts...)
+	fqName := cfg.fqName(name)
+	if err := validateDescWithConstLabels(fqName, labels, cfg.ConstLabels); err != nil {
+		panic(err)
+	}
+	if slices.Contains(labels, bucket_label) {
+		panic(fmt.Errorf("%w: %q is reserved for buckets of histogram %s", ErrInvalidName, bucket_label, fqName))
+	}
+	if _, ok := cfg.ConstLabels[bucket_label]; ok {
+		panic(fmt.Errorf("%w: %q is reserved for buckets of histogram %s", ErrInvalidName, bucket_label, fqName))
+	}
 	if len(buckets) == 0 {
-		buckets = defaultBuckets
-	}
-
-	vecCount := NewVec(
-		name+"_count",
-		labels,
-		&counterVec{
-			cv: prometheus.NewCounterVec(
-				prometheus.CounterOpts{
-					Name: name + "_count",
-					Help: help,
-				},
-				labels,
-			),
-		},
-	)
+		buckets = DefaultBuckets
+	}
+	buckets, err := validateBuckets(buckets)
+	if err != nil {
+		panic(fmt.Errorf("histogram %s: %w", fqName, err))
+	}
+	if cfg.NativeHistogram && (cfg.NativeSchema < minNativeSchema || cfg.NativeSchema > maxNativeSchema) {
+		panic(fmt.Errorf("%w: native schema %d of histogram %s is not in [%d, %d]",
+			ErrInvalidBuckets, cfg.NativeSchema, fqName, minNativeSchema, maxNativeSchema))
+	}
 
-	vecSum := NewVec(
-		name+"_sum",
-		labels,
-		&counterVec{
-			cv: prometheus.NewCounterVec(
-				prometheus.CounterOpts{
-					Name: name + "_sum",
-					Help: help,
-				},
-				labels,
-			),
-		},
-	)
+	// created timestamps are handled by PBHistogram, as the label values of buckets, count and sum share one
+	opts = append(slices.Clip(opts), withoutCreated())
+	vecCount := NewVec(name+"_count", labels, newCounterVec(fqName+"_count", help, labels, cfg.ConstLabels), opts...)
 
-	// add bucket_label
-	labels = append(labels, bucket_label)
-	if buckets == nil {
-		buckets = defaultBuckets
-	}
-
-	vec := NewVec(
-		name+"_bucket",
-		labels,
-		&counterVec{
-			cv: prometheus.NewCounterVec(
-				prometheus.CounterOpts{
-					Name: name + "_bucket",
-					Help: help,
-				},
-				labels,
-			),
-		},
-	)
+	// the max series limit is applied by count, buckets and sum follow the label values of count
+	vecOpts := append(slices.Clip(opts), WithMaxSeries(0))
+
+	// sum decreases with negative observations, so it is a gauge
+	vecSum := NewVec(name+"_sum", labels, newGaugeVec(fqName+"_sum", help, labels, cfg.ConstLabels), vecOpts...)
+
+	desc := prometheus.NewDesc(fqName, help, labels, cfg.ConstLabels)
+
+	// add bucket_label, clip labels to avoid modifying the caller's slice
+	labels = append(slices.Clip(labels), bucket_label)
+
+	vec := NewVec(name+"_bucket", labels, newCounterVec(fqName+"_bucket", help, labels, cfg.ConstLabels), vecOpts...)
 
 	return &PBHistogram{
+		name:    fqName,
+		help:    help,
 		vec:     vec,
 		buckets: buckets,
 		count:   vecCount,
 		sum:     vecSum,
+		desc:    desc,
+		cfg:     cfg,
 	}
 }
 
@@ -119,162 +146,573 @@ func (hg *PBHistogram) Name() string {
 	return hg.vec.Name()
 }
 
-// Implement PBMetric interface
-// timestamp: timestamp is in ms format
-func (hg *PBHistogram) TimeSeries(timestamp int64) []*prompb.TimeSeries {
-	cn := len(hg.count.LabelValues())
-	if cn == 0 {
-		return nil
+// Implement PBDescriber interface
+// Labels of Desc not include bucket_label
+// The created series is described as a gauge if WithCreatedSeries is set
+func (hg *PBHistogram) Descs() []*Desc {
+	desc := &Desc{
+		Name:   hg.name,
+		Help:   hg.help,
+		Type:   prompb.MetricMetadata_HISTOGRAM,
+		Labels: hg.count.Labels(),
+
+		ConstLabels: hg.cfg.ConstLabels,
+	}
+	if hg.cfg.CreatedSeries {
+		return []*Desc{desc, createdDesc(desc)}
 	}
+	return []*Desc{desc}
+}
 
-	tsGenerator := func(vec *Vec) []*prompb.TimeSeries {
-		tsList := make([]*prompb.TimeSeries, 0, len(vec.LabelValues()))
-		for _, lvs := range vec.LabelValues() {
-			if len(lvs) != len(vec.Labels()) {
-				slog.Error("labels and labelvalues not match", "labels", vec.Labels(), "labelvalues", lvs)
-				continue
-			}
-			m, err := vec.GetMetricWithLabelValues(lvs...)
-			if err != nil {
-				continue
-			}
-			v, err := GetMetricValue(m)
-			if err != nil {
-				slog.Error("GetMetricValue failed", "err", err)
-			}
+// Implement prometheus.Collector interface
+func (hg *PBHistogram) Describe(ch chan<- *prometheus.Desc) {
+	ch <- hg.desc
+}
 
-			pblabels := prompbLabels(vec.Name(), vec.Labels(), lvs)
-			sample := &prompb.Sample{
-				Value:     v,
-				Timestamp: timestamp,
-			}
-			ts := &prompb.TimeSeries{
-				Labels:  pblabels,
-				Samples: []*prompb.Sample{sample},
-			}
-			tsList = append(tsList, ts)
+// Implement prometheus.Collector interface
+// A const histogram is generated from the underlying CounterVecs for each label values
+func (hg *PBHistogram) Collect(ch chan<- prometheus.Metric) {
+	for _, hv := range hg.values() {
+		les, bvs, count, _ := hg.cumulative(hv)
+		buckets := make(map[float64]uint64, len(les))
+		for i, le := range les {
+			buckets[le] = uint64(bvs[i])
 		}
-		return tsList
+		m, err := prometheus.NewConstHistogram(hg.desc, uint64(count), hv.sum, buckets, hv.lvs...)
+		if err != nil {
+			slog.Error("NewConstHistogram failed", "err", err)
+			continue
+		}
+		ch <- m
 	}
+}
 
-	tsList := make([]*prompb.TimeSeries, 0, cn+cn+cn+cn*len(hg.buckets)) // sum, count, inf = cn, cn*len(buckets) = bucket
-	tsList = append(tsList, tsGenerator(hg.vec)...)
+// histogramValue is the state of a histogram with specific label values
+type histogramValue struct {
+	lvs     []string            // not include bucket_label
+	buckets map[float64]float64 // le -> value, not include le=+Inf
+	count   float64
+	sum     float64
+	created int64 // unix nano of the creation of count
+	updated int64 // unix nano of the last update of buckets, count and sum, only maintained if WithTTL is set
+}
 
-	var ts_sum = make([]*prompb.TimeSeries, 0, cn)
-	ts_sum = append(ts_sum, tsGenerator(hg.sum)...)
+// values reads the state of each label values from the underlying Vecs
+func (hg *PBHistogram) values() []*histogramValue {
+	hg.mtx.Lock()
+	defer hg.mtx.Unlock()
 
-	var ts_count = make([]*prompb.TimeSeries, 0, cn)
-	tslist := tsGenerator(hg.count)
-	ts_count = append(ts_count, tslist...)
+	return hg.readValues()
+}
 
-	var ts_inf = make([]*prompb.TimeSeries, 0, cn)
-	{
-		tslist := tsGenerator(hg.count)
-		for _, ts := range tslist {
-			// 把末尾的_count 改成 _bucket
-			for _, l := range ts.Labels {
+// unexpiredValues is like values but deletes the expired label values, see expire
+func (hg *PBHistogram) unexpiredValues() []*histogramValue {
+	hg.mtx.Lock()
+	defer hg.mtx.Unlock()
 
-				if l.Name == "__name__" {
-					l.Value = hg.vec.Name()
-				}
-			}
+	return hg.expire(hg.readValues())
+}
 
-			// 给每个ts增加le=+Inf
-			ts.Labels = append(ts.Labels, &prompb.Label{
-				Name:  bucket_label,
-				Value: strconv.FormatFloat(math.Inf(1), 'f', -1, 64),
+// readValues must be called with hg.mtx held for writing, so that no write is in progress
+func (hg *PBHistogram) readValues() []*histogramValue {
+	var (
+		hvs   []*histogramValue
+		index = map[string]*histogramValue{}
+	)
+	get := func(lvs []string) *histogramValue {
+		key := strings.Join(lvs, "\xff")
+		hv, ok := index[key]
+		if !ok {
+			hv = &histogramValue{lvs: lvs, buckets: map[float64]float64{}}
+			index[key] = hv
+			hvs = append(hvs, hv)
+		}
+		return hv
+	}
+	for _, smp := range hg.count.samples() {
+		hv := get(smp.lvs)
+		hv.count, hv.created, hv.updated = smp.value, smp.created, max(hv.updated, smp.updated)
+	}
+	for _, smp := range hg.sum.samples() {
+		hv := get(smp.lvs)
+		hv.sum, hv.updated = smp.value, max(hv.updated, smp.updated)
+	}
+	for _, smp := range hg.vec.samples() {
+		le, err := strconv.ParseFloat(smp.lvs[len(smp.lvs)-1], 64)
+		if err != nil || math.IsInf(le, 1) {
+			continue
+		}
+		hv := get(smp.lvs[:len(smp.lvs)-1])
+		hv.buckets[le], hv.updated = smp.value, max(hv.updated, smp.updated)
+	}
+	return hvs
+}
+
+// Implement PBMetric interface
+// timestamp: timestamp is in ms format
+// Buckets are validated and repaired to be cumulative, see cumulative
+// A native histogram series is generated for each label values if WithNativeSchema is set
+func (hg *PBHistogram) TimeSeries(timestamp int64) []*prompb.TimeSeries {
+	hvs := hg.unexpiredValues()
+	stale := hg.staleTimeSeries(timestamp)
+	if len(hvs)+len(stale) == 0 {
+		return nil
+	}
+
+	lastPush := hg.lastPush.Swap(timestamp)
+	tsList := make([]*prompb.TimeSeries, 0, len(hvs)*(len(hg.buckets)+3)) // buckets, +Inf, sum, count
+	var repaired [][]string
+	for _, hv := range hvs {
+		newTS := func(name string, labels, lvs []string, v float64) *prompb.TimeSeries {
+			return &prompb.TimeSeries{
+				Labels:  prompbLabels(name, labels, lvs, hg.cfg.ConstLabels),
+				Samples: pushSamples(hg.cfg, v, hv.created, lastPush, timestamp),
+			}
+		}
+		les, bvs, count, ok := hg.cumulative(hv)
+		if ok {
+			repaired = append(repaired, hv.lvs)
+		}
+		for i, le := range les {
+			lvs := append(slices.Clip(hv.lvs), formatFloat(le)) // add bucket_label
+			tsList = append(tsList, newTS(hg.vec.Name(), hg.vec.Labels(), lvs, bvs[i]))
+		}
+		lvs := append(slices.Clip(hv.lvs), formatFloat(math.Inf(1))) // le=+Inf is generated by count
+		tsList = append(tsList,
+			newTS(hg.vec.Name(), hg.vec.Labels(), lvs, count),
+			newTS(hg.sum.Name(), hg.sum.Labels(), hv.lvs, hv.sum),
+			newTS(hg.count.Name(), hg.count.Labels(), hv.lvs, count), // same as +Inf after repair
+		)
+		if hg.cfg.CreatedSeries {
+			tsList = append(tsList, createdTimeSeries(hg.name, hg.count.Labels(), hv.lvs, hg.cfg.ConstLabels, hv.created, timestamp))
+		}
+		if hg.cfg.NativeHistogram {
+			tsList = append(tsList, &prompb.TimeSeries{
+				Labels:     prompbLabels(hg.name, hg.count.Labels(), hv.lvs, hg.cfg.ConstLabels),
+				Histograms: []*prompb.Histogram{classicToNative(les, bvs, count, hv.sum, hg.cfg.NativeSchema, timestamp)},
 			})
-			ts_inf = append(ts_inf, ts)
 		}
 	}
+	hg.reportRepairs(repaired)
+
+	return append(tsList, stale...)
+}
+
+// reportRepairs logs and counts by HistogramRepairCounter the label values repaired by a TimeSeries call,
+// a label values is reported once until its buckets are found cumulative again,
+// so that a bad input is not reported on every push and the counter measures inconsistent inputs
+func (hg *PBHistogram) reportRepairs(repaired [][]string) {
+	hg.repairMtx.Lock()
+	defer hg.repairMtx.Unlock()
+
+	current := make(map[string]struct{}, len(repaired))
+	for _, lvs := range repaired {
+		key := strings.Join(lvs, "\xff")
+		current[key] = struct{}{}
+		if _, ok := hg.repaired[key]; ok {
+			continue
+		}
+		slog.Warn("histogram buckets are not cumulative, repaired", "name", hg.name, "labelvalues", lvs)
+		HistogramRepairCounter.WithLabelValues(hg.name).Inc()
+	}
+	hg.repaired = current
+}
+
+// expire deletes the label values whose buckets, count and sum are all not updated within TTL, with staleness markers,
+// return the unexpired ones
+// expire must be called with hg.mtx held for writing, so that no write lands between reading and deleting
+func (hg *PBHistogram) expire(hvs []*histogramValue) []*histogramValue {
+	if hg.cfg.TTL <= 0 {
+		return hvs
+	}
+	deadline := hg.cfg.now().Add(-hg.cfg.TTL).UnixNano()
 
-	tsList = append(tsList, ts_sum...)
-	tsList = append(tsList, ts_count...)
-	tsList = append(tsList, ts_inf...)
+	return slices.DeleteFunc(hvs, func(hv *histogramValue) bool {
+		if hv.updated >= deadline {
+			return false
+		}
+		hg.vec.deletePartialMatch(hg.labels(hv.lvs), true)
+		hg.count.delete(hv.lvs, true)
+		hg.sum.delete(hv.lvs, true)
+		return true
+	})
+}
 
+// staleTimeSeries generates staleness markers for the deleted label values,
+// le=+Inf is generated by count
+func (hg *PBHistogram) staleTimeSeries(timestamp int64) []*prompb.TimeSeries {
+	var tsList []*prompb.TimeSeries
+	for _, lvs := range hg.vec.drainStale() {
+		tsList = append(tsList, staleTimeSeries(hg.vec.Name(), hg.vec.Labels(), lvs, hg.cfg.ConstLabels, timestamp))
+	}
+	for _, lvs := range hg.sum.drainStale() {
+		tsList = append(tsList, staleTimeSeries(hg.sum.Name(), hg.sum.Labels(), lvs, hg.cfg.ConstLabels, timestamp))
+	}
+	for _, lvs := range hg.count.drainStale() {
+		inf := append(slices.Clip(lvs), formatFloat(math.Inf(1)))
+		tsList = append(tsList,
+			staleTimeSeries(hg.count.Name(), hg.count.Labels(), lvs, hg.cfg.ConstLabels, timestamp),
+			staleTimeSeries(hg.vec.Name(), hg.vec.Labels(), inf, hg.cfg.ConstLabels, timestamp),
+		)
+		// a float staleness marker also ends the native histogram series
+		if hg.cfg.NativeHistogram {
+			tsList = append(tsList, staleTimeSeries(hg.name, hg.count.Labels(), lvs, hg.cfg.ConstLabels, timestamp))
+		}
+		if hg.cfg.CreatedSeries {
+			tsList = append(tsList, staleTimeSeries(createdName(hg.name), hg.count.Labels(), lvs, hg.cfg.ConstLabels, timestamp))
+		}
+	}
 	return tsList
 }
 
+// cumulative returns the finite upper bounds in ascending order, the cumulative bucket values and the +Inf bucket value.
+// Observe maintains cumulative buckets, but a mix of Add and AddCount calls may not.
+// A bucket less than the previous one is raised to the previous one, and +Inf is raised to the last bucket if count is less,
+// the repaired +Inf is used as the count, repaired reports whether any value was raised.
+func (hg *PBHistogram) cumulative(hv *histogramValue) (les []float64, values []float64, inf float64, repaired bool) {
+	les = make([]float64, 0, len(hg.buckets)+len(hv.buckets))
+	les = append(les, hg.buckets...)
+	for le := range hv.buckets {
+		les = append(les, le)
+	}
+	slices.Sort(les)
+	les = slices.Compact(les)
+
+	var prev float64
+	values = make([]float64, len(les))
+	for i, le := range les {
+		v := hv.buckets[le]
+		if v < prev {
+			repaired = true
+			v = prev
+		}
+		values[i], prev = v, v
+	}
+	inf = hv.count
+	if inf < prev {
+		repaired = true
+		inf = prev
+	}
+	return les, values, inf, repaired
+}
+
 // prompbLabels generates []*prompb.Label based on lv and lvs, and adds the name label
-func prompbLabels(name string, lv, lvs []string) []*prompb.Label {
+// Labels are sorted by name as the remote write spec requires, labels with empty value are dropped
+func prompbLabels(name string, lv, lvs []string, constLabels map[string]string) []*prompb.Label {
 	if len(lv) != len(lvs) {
 		slog.Error("labels and labelvalues not match", "labels", lv, "labelvalues", lvs)
 		return nil
 	}
 
-	labels := make([]*prompb.Label, 0, len(lv)+1) // +1 for __name__
+	labels := make([]*prompb.Label, 0, len(lv)+len(constLabels)+1) // +1 for __name__
 
+	// add __name__
+	labels = append(labels, &prompb.Label{
+		Name:  model.MetricNameLabel,
+		Value: name,
+	})
 	for i, label := range lv {
+		if lvs[i] == "" {
+			continue
+		}
 		labels = append(labels, &prompb.Label{
 			Name:  label,
 			Value: lvs[i],
 		})
 	}
+	for label, value := range constLabels {
+		if value == "" {
+			continue
+		}
+		labels = append(labels, &prompb.Label{
+			Name:  label,
+			Value: value,
+		})
+	}
 
-	// add __name__
-	labels = slices.Insert(labels, 0,
-		&prompb.Label{
-			Name:  "__name__",
-			Value: name,
-		},
-	)
+	sortLabels(labels)
 	return labels
 }
 
 // lvs 不包含 bucket_label
 // Observe adds a single observation to the histogram.
+// Errors are logged, use TryObserve to handle them
 func (hg *PBHistogram) Observe(lvs []string, value float64) {
-	b := findBucket(hg.buckets, value)
-	if b <= 0 {
-		slog.Error("findBucket failed, no bucket found with the value", "value", value)
-		return
+	if err := hg.TryObserve(lvs, value); err != nil {
+		slog.Error("PBHistogram.Observe failed", "name", hg.name, "labelvalues", lvs, "value", value, "err", err)
+	}
+}
+
+// TryObserve is like Observe but returns an error instead of logging it
+// Buckets are cumulative, the observation is added to every bucket with value <= le,
+// and to the +Inf bucket which is generated by count.
+func (hg *PBHistogram) TryObserve(lvs []string, value float64) error {
+	return hg.TryObserveN(lvs, value, 1)
+}
+
+// ObserveN adds an observation of value which happened n times, e.g. pre-aggregated data.
+// n is a weight, it may be fractional but must not be negative.
+// Errors are logged, use TryObserveN to handle them
+func (hg *PBHistogram) ObserveN(lvs []string, value float64, n float64) {
+	if err := hg.TryObserveN(lvs, value, n); err != nil {
+		slog.Error("PBHistogram.ObserveN failed", "name", hg.name, "labelvalues", lvs, "value", value, "n", n, "err", err)
+	}
+}
+
+// TryObserveN is like ObserveN but returns an error instead of logging it
+func (hg *PBHistogram) TryObserveN(lvs []string, value float64, n float64) error {
+	if err := checkCounterValue(n); err != nil {
+		return fmt.Errorf("n: %w", err)
+	}
+	counts := make([]float64, len(hg.buckets))
+	for i, b := range hg.buckets {
+		if value <= b {
+			counts[i] = n
+		}
+	}
+	var sum float64
+	if n != 0 {
+		sum = value * n
+	}
+	return hg.observe(lvs, counts, n, sum)
+}
+
+// ObserveBatch adds the observations of values.
+// Errors are logged, use TryObserveBatch to handle them
+func (hg *PBHistogram) ObserveBatch(lvs []string, values []float64) {
+	if err := hg.TryObserveBatch(lvs, values); err != nil {
+		slog.Error("PBHistogram.ObserveBatch failed", "name", hg.name, "labelvalues", lvs, "values", len(values), "err", err)
+	}
+}
+
+// TryObserveBatch is like ObserveBatch but returns an error instead of logging it
+func (hg *PBHistogram) TryObserveBatch(lvs []string, values []float64) error {
+	var (
+		counts = make([]float64, len(hg.buckets))
+		sum    float64
+	)
+	for _, v := range values {
+		// count v in the lowest bucket containing it, then accumulate
+		if i := sort.SearchFloat64s(hg.buckets, v); i < len(counts) {
+			counts[i]++
+		}
+		sum += v
+	}
+	for i := 1; i < len(counts); i++ {
+		counts[i] += counts[i-1]
+	}
+	return hg.observe(lvs, counts, float64(len(values)), sum)
+}
+
+// observe adds the cumulative bucket counts, count and sum of lvs together,
+// a concurrent TimeSeries or Snapshot sees either none or all of them
+func (hg *PBHistogram) observe(lvs []string, counts []float64, n float64, sum float64) error {
+	hg.mtx.RLock()
+	defer hg.mtx.RUnlock()
+
+	lvs, err := hg.admit(lvs)
+	if err != nil {
+		return err
 	}
+	for i, b := range hg.buckets {
+		// add 0 to create the bucket, so that all buckets are generated in the TimeSeries
+		if err := hg.vec.TryAdd(append(slices.Clip(lvs), formatFloat(b)), counts[i]); err != nil {
+			return err
+		}
+	}
+	if err := hg.count.TryAdd(lvs, n); err != nil {
+		return err
+	}
+	return hg.sum.TryAdd(lvs, sum)
+}
+
+// ObserveWith is like Observe but takes labels instead of label values, errors are logged
+func (hg *PBHistogram) ObserveWith(labels prometheus.Labels, value float64) {
+	if err := hg.TryObserveWith(labels, value); err != nil {
+		slog.Error("PBHistogram.ObserveWith failed", "name", hg.name, "labels", labels, "value", value, "err", err)
+	}
+}
 
-	hg.count.Add(lvs, 1)
-	hg.sum.Add(lvs, value)
+// TryObserveWith is like TryObserve but takes labels instead of label values
+// labels must contain exactly the labels of PBHistogram without bucket_label
+func (hg *PBHistogram) TryObserveWith(labels prometheus.Labels, value float64) error {
+	lvs, err := hg.count.labelValues(labels)
+	if err != nil {
+		return err
+	}
+	return hg.TryObserve(lvs, value)
+}
 
-	lvs = append(lvs, strconv.FormatFloat(b, 'f', -1, 64)) // add bucket_label
-	hg.vec.Add(lvs, 1)
+// admit validates lvs and creates the count of lvs if not exist,
+// return the label values to use, which are the overflow label values if the max series limit is hit
+func (hg *PBHistogram) admit(lvs []string) ([]string, error) {
+	s, err := hg.count.getOrCreate(lvs, true)
+	if err != nil {
+		return nil, err
+	}
+	return s.lvs, nil
 }
 
 // Add add the value to the corresponding bucket.
 // Do not add a bucket with le=+Inf, as the +Inf bucket will be automatically generated in the TimeSeries
 // lvs must not include bucket_label
+// Add, AddCount and AddSum are not kept consistent with each other, use ObserveN or ObserveBatch for pre-aggregated data
+// Errors are logged, use TryAdd to handle them
 func (hg *PBHistogram) Add(lvs []string, value float64, le float64) {
-	lvs = append(lvs, strconv.FormatFloat(le, 'f', -1, 64)) // add bucket_label
-	hg.vec.Add(lvs, value)
+	if err := hg.TryAdd(lvs, value, le); err != nil {
+		slog.Error("PBHistogram.Add failed", "name", hg.name, "labelvalues", lvs, "value", value, "le", le, "err", err)
+	}
+}
+
+// TryAdd is like Add but returns an error instead of logging it
+func (hg *PBHistogram) TryAdd(lvs []string, value float64, le float64) error {
+	if err := checkCounterValue(value); err != nil {
+		return err
+	}
+	hg.mtx.RLock()
+	defer hg.mtx.RUnlock()
+
+	lvs, err := hg.admit(lvs)
+	if err != nil {
+		return err
+	}
+	lvs = append(slices.Clip(lvs), strconv.FormatFloat(le, 'f', -1, 64)) // add bucket_label
+	return hg.vec.TryAdd(lvs, value)
 }
 
+// Errors are logged, use TryAddCount to handle them
 func (hg *PBHistogram) AddCount(lvs []string, c float64) {
-	hg.count.Add(lvs, float64(c))
+	if err := hg.TryAddCount(lvs, c); err != nil {
+		slog.Error("PBHistogram.AddCount failed", "name", hg.name, "labelvalues", lvs, "value", c, "err", err)
+	}
 }
 
+// TryAddCount is like AddCount but returns an error instead of logging it
+func (hg *PBHistogram) TryAddCount(lvs []string, c float64) error {
+	if err := checkCounterValue(c); err != nil {
+		return err
+	}
+	hg.mtx.RLock()
+	defer hg.mtx.RUnlock()
+
+	lvs, err := hg.admit(lvs)
+	if err != nil {
+		return err
+	}
+	return hg.count.TryAdd(lvs, c)
+}
+
+// Errors are logged, use TryAddSum to handle them
 func (hg *PBHistogram) AddSum(lvs []string, s float64) {
-	hg.sum.Add(lvs, s)
+	if err := hg.TryAddSum(lvs, s); err != nil {
+		slog.Error("PBHistogram.AddSum failed", "name", hg.name, "labelvalues", lvs, "value", s, "err", err)
+	}
+}
+
+// TryAddSum is like AddSum but returns an error instead of logging it
+// s can be negative, as the sum of negative observations decreases
+func (hg *PBHistogram) TryAddSum(lvs []string, s float64) error {
+	hg.mtx.RLock()
+	defer hg.mtx.RUnlock()
+
+	lvs, err := hg.admit(lvs)
+	if err != nil {
+		return err
+	}
+	return hg.sum.TryAdd(lvs, s)
 }
 
-// TODO: eset count and sum to zero, reinitialize vec
+// Reset deletes all label values, count and sum
 func (hg *PBHistogram) Reset() {
+	hg.mtx.Lock()
+	defer hg.mtx.Unlock()
+
+	hg.vec.Reset()
+	hg.count.Reset()
+	hg.sum.Reset()
 }
 
-func (hg *PBHistogram) Buckets() []float64 {
-	return hg.buckets
+// Merge adds the buckets, count and sum of each label values of other to hg, other is not modified,
+// e.g. to combine the histograms of worker goroutines before pushing.
+// Merge is additive and one-shot, merging the same other again counts it twice,
+// Reset other after merging it to merge only the new observations next time.
+// other must have the same labels and buckets as hg, otherwise ErrMergeMismatch is returned.
+func (hg *PBHistogram) Merge(other *PBHistogram) error {
+	if !slices.Equal(hg.count.Labels(), other.count.Labels()) || !slices.Equal(hg.buckets, other.buckets) {
+		return fmt.Errorf("%w: %s has labels %v and buckets %v, %s has labels %v and buckets %v",
+			ErrMergeMismatch, hg.name, hg.count.Labels(), hg.buckets, other.name, other.count.Labels(), other.buckets)
+	}
+	for _, hv := range other.values() {
+		if err := hg.merge(hv); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// return value:
-//  1. <0: error
-//  2. 0: no bucket
-//  3. >0: bucket value
-func findBucket(buckets []float64, value float64) float64 {
-	if !slices.IsSorted(buckets) {
-		return -1
+func (hg *PBHistogram) merge(hv *histogramValue) error {
+	hg.mtx.RLock()
+	defer hg.mtx.RUnlock()
+
+	lvs, err := hg.admit(hv.lvs)
+	if err != nil {
+		return err
 	}
-	for _, b := range buckets {
-		if value <= b {
-			return b
+	for le, v := range hv.buckets {
+		if err := hg.vec.TryAdd(append(slices.Clip(lvs), formatFloat(le)), v); err != nil {
+			return err
 		}
 	}
-	return 0
+	if err := hg.count.TryAdd(lvs, hv.count); err != nil {
+		return err
+	}
+	return hg.sum.TryAdd(lvs, hv.sum)
+}
+
+// Delete deletes the buckets, count and sum of the label values, return whether the label values existed
+// lvs must not include bucket_label
+func (hg *PBHistogram) Delete(lvs []string) bool {
+	if len(lvs) != len(hg.count.Labels()) {
+		return false
+	}
+
+	hg.mtx.Lock()
+	defer hg.mtx.Unlock()
+
+	hg.vec.DeletePartialMatch(hg.labels(lvs))
+	deleted := hg.count.Delete(lvs)
+	return hg.sum.Delete(lvs) || deleted
+}
+
+// labels returns the labels of lvs, lvs must not include bucket_label
+func (hg *PBHistogram) labels(lvs []string) prometheus.Labels {
+	labels := make(prometheus.Labels, len(lvs))
+	for i, label := range hg.count.Labels() {
+		labels[label] = lvs[i]
+	}
+	return labels
+}
+
+// DeletePartialMatch deletes the buckets, count and sum of all label values matching the given labels,
+// return the number of deleted label values
+// labels must not include bucket_label
+func (hg *PBHistogram) DeletePartialMatch(labels prometheus.Labels) int {
+	if _, ok := labels[bucket_label]; ok {
+		return 0
+	}
+
+	hg.mtx.Lock()
+	defer hg.mtx.Unlock()
+
+	hg.vec.DeletePartialMatch(labels)
+	n := hg.count.DeletePartialMatch(labels)
+	return max(n, hg.sum.DeletePartialMatch(labels))
+}
+
+// Buckets returns the upper bounds not include +Inf, which is generated by count
+// The returned buckets must not be modified
+func (hg *PBHistogram) Buckets() []float64 {
+	return hg.buckets
 }
 
 // Labels contains bucket_label but not include __name__
@@ -289,22 +727,14 @@ func (hg *PBHistogram) LabelValues() [][]string {
 	return hg.vec.LabelValues()
 }
 
-// lvs must not include bucket_label
+// lvs must include bucket_label value at the end
 func (hg *PBHistogram) GetBucketValue(lvs []string) (float64, error) {
-	m, err := hg.vec.GetMetricWithLabelValues(lvs...)
-	if err != nil {
-		return 0, err
-	}
-	return GetMetricValue(m)
+	return hg.vec.Value(lvs)
 }
 
 // XXX_count
 func (hg *PBHistogram) GetCountValue(lvs []string) (int, error) {
-	m, err := hg.count.GetMetricWithLabelValues(lvs...)
-	if err != nil {
-		return 0, err
-	}
-	f, err := GetMetricValue(m)
+	f, err := hg.count.Value(lvs)
 	if err != nil {
 		return 0, err
 	}
@@ -314,9 +744,5 @@ func (hg *PBHistogram) GetCountValue(lvs []string) (int, error) {
 
 // XXX_sum
 func (hg *PBHistogram) Sum(lvs []string) (float64, error) {
-	m, err := hg.sum.GetMetricWithLabelValues(lvs...)
-	if err != nil {
-		return 0, err
-	}
-	return GetMetricValue(m)
+	return hg.sum.Value(lvs)
 }
@@ -1,11 +1,17 @@
 package metric
 
 import (
+	"errors"
 	"log"
+	"math"
 	"reflect"
+	"slices"
 	"sort"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/sq325/remoteWrite/prompb"
 )
 
@@ -379,3 +385,524 @@ func TSDebug(ts *prompb.TimeSeries) {
 	}
 	log.Printf("%s{%s} @%d %f", metricName, labels, timestamp, value)
 }
+
+func TestPBHistogram_TryObserve(t *testing.T) {
+	hg := NewPBHistogram("test_histogram", "Test Histogram", []string{"label1"}, []float64{10, 20})
+	if err := hg.TryObserve([]string{"value1"}, -5); err != nil {
+		t.Errorf("PBHistogram.TryObserve() error = %v", err)
+	}
+	if err := hg.TryObserve([]string{"value1", "value2"}, 1); !errors.Is(err, ErrLabelValuesMismatch) {
+		t.Errorf("PBHistogram.TryObserve() error = %v, wantErr %v", err, ErrLabelValuesMismatch)
+	}
+	sum, err := hg.Sum([]string{"value1"})
+	if err != nil || sum != -5 {
+		t.Errorf("PBHistogram.Sum() = %v, %v, want %v", sum, err, -5)
+	}
+}
+
+func TestPBHistogram_TryAddRejected(t *testing.T) {
+	hg := NewPBHistogram("test_histogram", "Test Histogram", []string{"label1"}, []float64{10, 20})
+	if err := hg.TryAdd([]string{"value1"}, -1, 10); !errors.Is(err, ErrNegativeValue) {
+		t.Errorf("PBHistogram.TryAdd() error = %v, wantErr %v", err, ErrNegativeValue)
+	}
+	if err := hg.TryAddCount([]string{"value1"}, -1); !errors.Is(err, ErrNegativeValue) {
+		t.Errorf("PBHistogram.TryAddCount() error = %v, wantErr %v", err, ErrNegativeValue)
+	}
+	if got := hg.TimeSeries(1); len(got) != 0 {
+		t.Errorf("PBHistogram.TimeSeries() = %d series, want 0", len(got))
+	}
+}
+
+func TestPBHistogram_Observe(t *testing.T) {
+	hg := NewPBHistogram("test_histogram", "Test Histogram", []string{"label1"}, []float64{-1, 0, 1, 2})
+	for _, v := range []float64{-2, -1, 0.5, 1, 3} {
+		hg.Observe([]string{"value1"}, v)
+	}
+
+	want := map[string]float64{
+		`test_histogram_bucket{label1="value1",le="-1"}`:   2,
+		`test_histogram_bucket{label1="value1",le="0"}`:    2,
+		`test_histogram_bucket{label1="value1",le="1"}`:    4,
+		`test_histogram_bucket{label1="value1",le="2"}`:    4,
+		`test_histogram_bucket{label1="value1",le="+Inf"}`: 5,
+		`test_histogram_sum{label1="value1"}`:              1.5,
+		`test_histogram_count{label1="value1"}`:            5,
+	}
+	got := map[string]float64{}
+	for _, ts := range hg.TimeSeries(1722838400634) {
+		got[seriesString(ts)] = ts.Samples[0].Value
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PBHistogram.TimeSeries() = %v, want %v", got, want)
+	}
+}
+
+func TestPBHistogram_TimeSeries_Repair(t *testing.T) {
+	hg := NewPBHistogram("test_histogram_repair", "Test Histogram", []string{"label1"}, []float64{1, 2, 3})
+	hg.Add([]string{"value1"}, 5, 1)
+	hg.Add([]string{"value1"}, 3, 2)
+	hg.Add([]string{"value1"}, 6, 3)
+	hg.AddCount([]string{"value1"}, 4)
+
+	want := map[string]float64{
+		`test_histogram_repair_bucket{label1="value1",le="1"}`:    5,
+		`test_histogram_repair_bucket{label1="value1",le="2"}`:    5,
+		`test_histogram_repair_bucket{label1="value1",le="3"}`:    6,
+		`test_histogram_repair_bucket{label1="value1",le="+Inf"}`: 6,
+		`test_histogram_repair_sum{label1="value1"}`:              0,
+		`test_histogram_repair_count{label1="value1"}`:            6, // raised with +Inf
+	}
+	got := map[string]float64{}
+	for _, ts := range hg.TimeSeries(1722838400634) {
+		got[seriesString(ts)] = ts.Samples[0].Value
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PBHistogram.TimeSeries() = %v, want %v", got, want)
+	}
+	if got := testutil.ToFloat64(HistogramRepairCounter.WithLabelValues("test_histogram_repair")); got != 1 {
+		t.Errorf("HistogramRepairCounter = %v, want %v", got, 1)
+	}
+
+	// reads and later pushes of the same bad input are not counted again
+	hg.Snapshot([]string{"value1"})
+	testutil.CollectAndCount(hg)
+	hg.TimeSeries(1722838401634)
+	if got := testutil.ToFloat64(HistogramRepairCounter.WithLabelValues("test_histogram_repair")); got != 1 {
+		t.Errorf("HistogramRepairCounter = %v, want %v", got, 1)
+	}
+
+	// counted again after the buckets become cumulative and then not cumulative again
+	hg.Add([]string{"value1"}, 2, 2)
+	hg.AddCount([]string{"value1"}, 2)
+	hg.TimeSeries(1722838402634)
+	hg.Add([]string{"value1"}, 1, 1)
+	hg.TimeSeries(1722838403634)
+	if got := testutil.ToFloat64(HistogramRepairCounter.WithLabelValues("test_histogram_repair")); got != 2 {
+		t.Errorf("HistogramRepairCounter = %v, want %v", got, 2)
+	}
+}
+
+func TestPBHistogram_Delete(t *testing.T) {
+	hg := NewPBHistogram("test_histogram", "Test Histogram", []string{"label1"}, []float64{1, 2}, WithStaleMarkers())
+	hg.Observe([]string{"value1"}, 1)
+	hg.Observe([]string{"value2"}, 1)
+
+	if !hg.Delete([]string{"value1"}) {
+		t.Errorf("PBHistogram.Delete() = false, want true")
+	}
+	got := map[string]float64{}
+	for _, ts := range hg.TimeSeries(1722838400634) {
+		got[seriesString(ts)] = ts.Samples[0].Value
+	}
+	if len(got) != 10 {
+		t.Errorf("len(PBHistogram.TimeSeries()) = %d, want %d", len(got), 10)
+	}
+	for k, v := range got {
+		if strings.Contains(k, "value1") != IsStaleNaN(v) {
+			t.Errorf("PBHistogram.TimeSeries() %s = %v", k, v)
+		}
+	}
+
+	hg.Reset()
+	if got := len(hg.TimeSeries(1722838400634)); got != 5 {
+		t.Errorf("len(PBHistogram.TimeSeries()) after Reset = %d, want %d", got, 5)
+	}
+	if got := len(hg.TimeSeries(1722838400634)); got != 0 {
+		t.Errorf("len(PBHistogram.TimeSeries()) = %d, want %d", got, 0)
+	}
+}
+
+func TestPBHistogram_TTL(t *testing.T) {
+	now := time.Unix(1722838400, 0)
+	hg := NewPBHistogram("test_histogram", "Test Histogram", []string{"label1"}, []float64{1, 2}, WithTTL(time.Minute))
+	for _, cfg := range []*config{hg.cfg, hg.vec.cfg, hg.count.cfg, hg.sum.cfg} {
+		cfg.now = func() time.Time { return now }
+	}
+
+	hg.Observe([]string{"value1"}, 1)
+	hg.Observe([]string{"value2"}, 1)
+	now = now.Add(50 * time.Second)
+	hg.Observe([]string{"value2"}, 1)
+
+	now = now.Add(20 * time.Second)
+	var stale int
+	for _, ts := range hg.TimeSeries(1722838400634) {
+		if IsStaleNaN(ts.Samples[0].Value) {
+			stale++
+			if !strings.Contains(seriesString(ts), "value1") {
+				t.Errorf("PBHistogram.TimeSeries() %s is stale", seriesString(ts))
+			}
+		}
+	}
+	if stale != 5 {
+		t.Errorf("staleness markers = %d, want %d", stale, 5)
+	}
+	if got := len(hg.TimeSeries(1722838400634)); got != 5 {
+		t.Errorf("len(PBHistogram.TimeSeries()) = %d, want %d", got, 5)
+	}
+}
+
+func TestPBHistogram_MaxSeries(t *testing.T) {
+	hg := NewPBHistogram("test_histogram", "Test Histogram", []string{"label1"}, []float64{1, 2}, WithMaxSeries(1))
+	hg.Observe([]string{"value1"}, 1)
+	hg.Observe([]string{"value2"}, 1)
+	hg.Observe([]string{"value3"}, 3)
+
+	got := map[string]float64{}
+	for _, ts := range hg.TimeSeries(1722838400634) {
+		got[seriesString(ts)] = ts.Samples[0].Value
+	}
+	if len(got) != 10 {
+		t.Errorf("len(PBHistogram.TimeSeries()) = %d, want %d", len(got), 10)
+	}
+	if v := got[`test_histogram_count{label1="__overflow__"}`]; v != 2 {
+		t.Errorf("overflow count = %v, want %v", v, 2)
+	}
+	if v := got[`test_histogram_bucket{label1="__overflow__",le="1"}`]; v != 1 {
+		t.Errorf("overflow bucket = %v, want %v", v, 1)
+	}
+}
+
+func TestPBHistogram_ConstLabels(t *testing.T) {
+	hg := NewPBHistogram("latency", "test", []string{"path"}, []float64{1},
+		WithNamespace("app"), WithConstLabels(map[string]string{"service": "api"}))
+	hg.Observe([]string{"/"}, 0.5)
+
+	want := map[string]float64{
+		`app_latency_bucket{le="1",path="/",service="api"}`:    1,
+		`app_latency_bucket{le="+Inf",path="/",service="api"}`: 1,
+		`app_latency_sum{path="/",service="api"}`:              0.5,
+		`app_latency_count{path="/",service="api"}`:            1,
+	}
+	got := map[string]float64{}
+	for _, ts := range hg.TimeSeries(1) {
+		got[seriesString(ts)] = ts.Samples[0].Value
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PBHistogram.TimeSeries() = %v, want %v", got, want)
+	}
+	if got := hg.Descs()[0].Name; got != "app_latency" {
+		t.Errorf("PBHistogram.Descs() name = %v, want %v", got, "app_latency")
+	}
+}
+
+func TestNewPBHistogram_Buckets(t *testing.T) {
+	tests := []struct {
+		name    string
+		buckets []float64
+		want    []float64
+		wantErr bool
+	}{
+		{
+			name: "default",
+			want: DefaultBuckets,
+		},
+		{
+			name:    "linear",
+			buckets: LinearBuckets(1, 1, 3),
+			want:    []float64{1, 2, 3},
+		},
+		{
+			name:    "exponential",
+			buckets: ExponentialBuckets(1, 2, 3),
+			want:    []float64{1, 2, 4},
+		},
+		{
+			name:    "exponential range",
+			buckets: ExponentialBucketsRange(1, 100, 3),
+			want:    []float64{1, 10, 100},
+		},
+		{
+			name:    "+Inf is dropped",
+			buckets: []float64{1, 2, math.Inf(1)},
+			want:    []float64{1, 2},
+		},
+		{
+			name:    "unsorted",
+			buckets: []float64{2, 1},
+			wantErr: true,
+		},
+		{
+			name:    "duplicate",
+			buckets: []float64{1, 1},
+			wantErr: true,
+		},
+		{
+			name:    "+Inf twice",
+			buckets: []float64{1, math.Inf(1), math.Inf(1)},
+			wantErr: true,
+		},
+		{
+			name:    "NaN",
+			buckets: []float64{1, math.NaN()},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if (r != nil) != tt.wantErr {
+					t.Errorf("NewPBHistogram() panic = %v, wantErr %v", r, tt.wantErr)
+				}
+				if err, ok := r.(error); ok && !errors.Is(err, ErrInvalidBuckets) {
+					t.Errorf("NewPBHistogram() panic = %v, want ErrInvalidBuckets", err)
+				}
+			}()
+			hg := NewPBHistogram("test_histogram", "test", nil, tt.buckets)
+			if got := hg.Buckets(); !slices.Equal(got, tt.want) {
+				t.Errorf("PBHistogram.Buckets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPBHistogram_Quantile(t *testing.T) {
+	hg := NewPBHistogram("test_histogram", "test", []string{"label1"}, []float64{10, 20, 40})
+	for _, v := range []float64{5, 5, 15, 15, 15, 15, 30, 30, 50, 100} {
+		hg.Observe([]string{"a"}, v)
+	}
+
+	s, err := hg.Snapshot([]string{"a"})
+	if err != nil {
+		t.Fatalf("PBHistogram.Snapshot() error = %v", err)
+	}
+	wantBuckets := []Bucket{{10, 2}, {20, 6}, {40, 8}, {math.Inf(1), 10}}
+	if !reflect.DeepEqual(s.Buckets, wantBuckets) || s.Count != 10 || s.Sum != 280 {
+		t.Errorf("PBHistogram.Snapshot() = %+v", s)
+	}
+
+	tests := []struct {
+		q    float64
+		want float64
+	}{
+		{q: 0.1, want: 5},
+		{q: 0.5, want: 17.5},
+		{q: 0.7, want: 30},
+		{q: 0.99, want: 40}, // +Inf bucket returns the highest finite upper bound
+		{q: -1, want: math.Inf(-1)},
+		{q: 2, want: math.Inf(1)},
+	}
+	for _, tt := range tests {
+		got, err := hg.Quantile([]string{"a"}, tt.q)
+		if err != nil || got != tt.want {
+			t.Errorf("PBHistogram.Quantile(%v) = %v, %v, want %v", tt.q, got, err, tt.want)
+		}
+	}
+
+	if got, err := hg.Mean([]string{"a"}); err != nil || got != 28 {
+		t.Errorf("PBHistogram.Mean() = %v, %v, want %v", got, err, 28)
+	}
+	if got, err := hg.Quantile([]string{"b"}, 0.5); err != nil || !math.IsNaN(got) {
+		t.Errorf("PBHistogram.Quantile() of empty label values = %v, %v, want NaN", got, err)
+	}
+	if _, err := hg.Quantile([]string{"a", "b"}, 0.5); !errors.Is(err, ErrLabelValuesMismatch) {
+		t.Errorf("PBHistogram.Quantile() error = %v, want %v", err, ErrLabelValuesMismatch)
+	}
+}
+
+func TestPBHistogram_Merge(t *testing.T) {
+	hg := NewPBHistogram("test_histogram", "test", []string{"label1"}, []float64{1, 2})
+	other := NewPBHistogram("test_histogram", "test", []string{"label1"}, []float64{1, 2})
+	hg.Observe([]string{"a"}, 0.5)
+	other.Observe([]string{"a"}, 1.5)
+	other.Observe([]string{"a"}, 3)
+
+	if err := hg.Merge(other); err != nil {
+		t.Fatalf("PBHistogram.Merge() error = %v", err)
+	}
+	s, err := hg.Snapshot([]string{"a"})
+	if err != nil {
+		t.Fatalf("PBHistogram.Snapshot() error = %v", err)
+	}
+	want := &HistogramSnapshot{
+		LabelValues: []string{"a"},
+		Buckets:     []Bucket{{1, 1}, {2, 2}, {math.Inf(1), 3}},
+		Count:       3,
+		Sum:         5,
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("PBHistogram.Snapshot() after Merge = %+v, want %+v", s, want)
+	}
+
+	mismatch := NewPBHistogram("test_histogram", "test", []string{"label1"}, []float64{1, 5})
+	if err := hg.Merge(mismatch); !errors.Is(err, ErrMergeMismatch) {
+		t.Errorf("PBHistogram.Merge() error = %v, want %v", err, ErrMergeMismatch)
+	}
+}
+
+func TestNativeIndex(t *testing.T) {
+	tests := []struct {
+		v      float64
+		schema int32
+		want   int32
+	}{
+		{v: 1, schema: 0, want: 0},
+		{v: 2, schema: 0, want: 1},
+		{v: 3, schema: 0, want: 2},
+		{v: 4, schema: 0, want: 2},
+		{v: 0.5, schema: 0, want: -1},
+		{v: 1.2, schema: 1, want: 1},
+		{v: 2, schema: 1, want: 2},
+		{v: 3, schema: 1, want: 4},
+		{v: 2, schema: -1, want: 1},
+		{v: 4, schema: -1, want: 1},
+		{v: 5, schema: -1, want: 2},
+		{v: 0.5, schema: -1, want: 0},
+	}
+	for _, tt := range tests {
+		if got := nativeIndex(tt.v, tt.schema); got != tt.want {
+			t.Errorf("nativeIndex(%v, %d) = %d, want %d", tt.v, tt.schema, got, tt.want)
+		}
+	}
+}
+
+func TestPBHistogram_NativeSchema(t *testing.T) {
+	hg := NewPBHistogram("test_histogram", "test", []string{"label1"}, []float64{1, 2, 4}, WithNativeSchema(0))
+	for _, v := range []float64{0.5, 1.5, 3, 10} {
+		hg.Observe([]string{"a"}, v)
+	}
+
+	var native []*prompb.TimeSeries
+	tsList := hg.TimeSeries(1)
+	for _, ts := range tsList {
+		if len(ts.Histograms) > 0 {
+			native = append(native, ts)
+		}
+	}
+	if len(native) != 1 || len(tsList) != 7 {
+		t.Fatalf("PBHistogram.TimeSeries() = %d series with %d native, want 7 with 1", len(tsList), len(native))
+	}
+	if got := seriesString(native[0]); got != `test_histogram{label1="a"}` {
+		t.Errorf("native series = %s", got)
+	}
+	h := native[0].Histograms[0]
+	if h.GetCountFloat() != 4 || h.Sum != 15 || h.Schema != 0 || h.Timestamp != 1 {
+		t.Errorf("native histogram = %v", h)
+	}
+	wantSpans := []*prompb.BucketSpan{{Offset: 0, Length: 4}}
+	if len(h.PositiveSpans) != 1 || h.PositiveSpans[0].Offset != wantSpans[0].Offset || h.PositiveSpans[0].Length != wantSpans[0].Length {
+		t.Errorf("native histogram spans = %v, want %v", h.PositiveSpans, wantSpans)
+	}
+	if want := []float64{1, 1, 1, 1}; !slices.Equal(h.PositiveCounts, want) {
+		t.Errorf("native histogram counts = %v, want %v", h.PositiveCounts, want)
+	}
+}
+
+func TestNativeBuckets(t *testing.T) {
+	spans, counts := nativeBuckets(map[int32]float64{-2: 1, -1: 2, 3: 3, 4: 0, 5: 4})
+	got := make([][2]int64, 0, len(spans))
+	for _, s := range spans {
+		got = append(got, [2]int64{int64(s.Offset), int64(s.Length)})
+	}
+	if want := [][2]int64{{-2, 2}, {3, 1}, {1, 1}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("nativeBuckets() spans = %v, want %v", got, want)
+	}
+	if want := []float64{1, 2, 3, 4}; !slices.Equal(counts, want) {
+		t.Errorf("nativeBuckets() counts = %v, want %v", counts, want)
+	}
+}
+
+func TestPBHistogram_ObserveN(t *testing.T) {
+	tests := []struct {
+		name    string
+		observe func(hg *PBHistogram) error
+		want    *HistogramSnapshot
+		wantErr error
+	}{
+		{
+			name:    "observe n",
+			observe: func(hg *PBHistogram) error { return hg.TryObserveN([]string{"a"}, 1.5, 3) },
+			want: &HistogramSnapshot{
+				LabelValues: []string{"a"},
+				Buckets:     []Bucket{{1, 0}, {2, 3}, {math.Inf(1), 3}},
+				Count:       3,
+				Sum:         4.5,
+			},
+		},
+		{
+			name:    "negative n",
+			observe: func(hg *PBHistogram) error { return hg.TryObserveN([]string{"a"}, 1.5, -1) },
+			wantErr: ErrNegativeValue,
+		},
+		{
+			name:    "observe batch",
+			observe: func(hg *PBHistogram) error { return hg.TryObserveBatch([]string{"a"}, []float64{0.5, 1, 1.5, 3}) },
+			want: &HistogramSnapshot{
+				LabelValues: []string{"a"},
+				Buckets:     []Bucket{{1, 2}, {2, 3}, {math.Inf(1), 4}},
+				Count:       4,
+				Sum:         6,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hg := NewPBHistogram("test_histogram", "test", []string{"label1"}, []float64{1, 2})
+			if err := tt.observe(hg); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("observe error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			got, err := hg.Snapshot([]string{"a"})
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PBHistogram.Snapshot() = %+v, %v, want %+v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPBHistogram_ObserveConcurrent(t *testing.T) {
+	hg := NewPBHistogram("test_histogram", "test", []string{"label1"}, []float64{1, 2})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			hg.ObserveBatch([]string{"a"}, []float64{0.5, 1.5, 3})
+		}
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		s, err := hg.Snapshot([]string{"a"})
+		if err != nil {
+			t.Fatalf("PBHistogram.Snapshot() error = %v", err)
+		}
+		if s.Buckets[0].Count*3 != s.Count || s.Buckets[1].Count*3 != s.Count*2 {
+			t.Fatalf("PBHistogram.Snapshot() sees a partial batch: %+v", s)
+		}
+	}
+}
+
+func TestPBHistogram_Created(t *testing.T) {
+	now := time.UnixMilli(1000)
+	hg := NewPBHistogram("test_histogram", "test", nil, []float64{1}, WithCreatedSeries(), WithCreatedZeroSamples())
+	hg.count.cfg.now = func() time.Time { return now }
+	hg.Observe(nil, 0.5)
+
+	tsList := hg.TimeSeries(2000)
+	got := map[string][]*prompb.Sample{}
+	for _, ts := range tsList {
+		got[seriesString(ts)] = ts.Samples
+	}
+	if created := got[`test_histogram_created{}`]; len(created) != 1 || created[0].Value != 1 {
+		t.Errorf("created series = %v, want value %v", created, 1)
+	}
+	for _, name := range []string{`test_histogram_bucket{le="1"}`, `test_histogram_sum{}`, `test_histogram_count{}`} {
+		samples := got[name]
+		if len(samples) != 2 || samples[0].Value != 0 || samples[0].Timestamp != 1000 || samples[1].Timestamp != 2000 {
+			t.Errorf("%s samples = %v, want a zero sample at the created timestamp", name, samples)
+		}
+	}
+
+	// the zero sample is injected once
+	for _, ts := range hg.TimeSeries(3000) {
+		if len(ts.Samples) != 1 {
+			t.Errorf("%s samples = %v, want 1 sample", seriesString(ts), ts.Samples)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package metric
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// labels of the PBHistogram recording HTTP request durations
+const (
+	method_label = "method"
+	code_label   = "code"
+	route_label  = "route"
+)
+
+// NewHTTPDurationHistogram creates a PBHistogram with the labels method, code and route,
+// for InstrumentHandler and InstrumentRoundTripper.
+// Durations are in seconds and buckets default to prometheus.DefBuckets, WithDurationUnit in opts overrides the unit.
+func NewHTTPDurationHistogram(name string, help string, buckets []float64, opts ...Option) *PBHistogram {
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+	opts = append([]Option{WithDurationUnit(time.Second)}, opts...)
+	return NewPBHistogram(name, help, []string{method_label, code_label, route_label}, buckets, opts...)
+}
+
+// InstrumentHandler records the duration of each request served by next into hg by method, code and route.
+// hg must have exactly the labels method, code and route, see NewHTTPDurationHistogram, otherwise InstrumentHandler panics.
+// route is the route pattern of next, e.g. /users/{id}, it must not be the request path to keep the cardinality low.
+// The http.ResponseWriter passed to next implements http.Flusher, http.Hijacker and http.Pusher
+// only if the underlying one does.
+func InstrumentHandler(hg *PBHistogram, route string, next http.Handler) http.Handler {
+	mustHaveHTTPLabels(hg)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := NewTimer(hg, nil)
+		rw := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		next.ServeHTTP(rw.wrap(), r)
+		hg.ObserveWith(httpLabels(r.Method, strconv.Itoa(rw.code), route), t.since())
+	})
+}
+
+// InstrumentRoundTripper records the duration of each request sent by next into hg by method, code and route.
+// hg must have exactly the labels method, code and route, see NewHTTPDurationHistogram, otherwise InstrumentRoundTripper panics.
+// Requests returning an error have no status code, they are recorded with code "error".
+// next defaults to http.DefaultTransport if nil.
+func InstrumentRoundTripper(hg *PBHistogram, route string, next http.RoundTripper) http.RoundTripper {
+	mustHaveHTTPLabels(hg)
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		t := NewTimer(hg, nil)
+		resp, err := next.RoundTrip(r)
+		code := "error"
+		if err == nil {
+			code = strconv.Itoa(resp.StatusCode)
+		}
+		hg.ObserveWith(httpLabels(r.Method, code, route), t.since())
+		return resp, err
+	})
+}
+
+// since returns the duration since the Timer is created in the unit of the Timer, without observing it
+func (t *Timer) since() float64 {
+	return float64(t.now().Sub(t.start)) / float64(t.unit)
+}
+
+// mustHaveHTTPLabels panics if hg does not have exactly the labels method, code and route
+func mustHaveHTTPLabels(hg *PBHistogram) {
+	labels := slices.Clone(hg.count.Labels())
+	slices.Sort(labels)
+	if want := []string{code_label, method_label, route_label}; !slices.Equal(labels, want) {
+		panic(fmt.Errorf("%w: %s has labels %v, want %v", ErrLabelValuesMismatch, hg.name, hg.count.Labels(), want))
+	}
+}
+
+func httpLabels(method string, code string, route string) prometheus.Labels {
+	return prometheus.Labels{
+		method_label: method,
+		code_label:   code,
+		route_label:  route,
+	}
+}
+
+type roundTripperFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// statusRecorder records the status code written by a http.Handler
+type statusRecorder struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+}
+
+// WriteHeader records the first final status code, informational 1xx codes are not final
+func (rw *statusRecorder) WriteHeader(code int) {
+	if !rw.wroteHeader && code >= 200 {
+		rw.code, rw.wroteHeader = code, true
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *statusRecorder) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	return rw.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the underlying http.ResponseWriter for http.ResponseController
+func (rw *statusRecorder) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// wrap returns rw implementing the optional interfaces http.Flusher, http.Hijacker and http.Pusher
+// which the underlying http.ResponseWriter implements, so that the type assertions of handlers hold
+func (rw *statusRecorder) wrap() http.ResponseWriter {
+	_, isFlusher := rw.ResponseWriter.(http.Flusher)
+	h, isHijacker := rw.ResponseWriter.(http.Hijacker)
+	p, isPusher := rw.ResponseWriter.(http.Pusher)
+	f := recorderFlusher{rw}
+
+	switch {
+	case isFlusher && isHijacker && isPusher:
+		return struct {
+			*statusRecorder
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{rw, f, h, p}
+	case isFlusher && isHijacker:
+		return struct {
+			*statusRecorder
+			http.Flusher
+			http.Hijacker
+		}{rw, f, h}
+	case isFlusher && isPusher:
+		return struct {
+			*statusRecorder
+			http.Flusher
+			http.Pusher
+		}{rw, f, p}
+	case isHijacker && isPusher:
+		return struct {
+			*statusRecorder
+			http.Hijacker
+			http.Pusher
+		}{rw, h, p}
+	case isFlusher:
+		return struct {
+			*statusRecorder
+			http.Flusher
+		}{rw, f}
+	case isHijacker:
+		return struct {
+			*statusRecorder
+			http.Hijacker
+		}{rw, h}
+	case isPusher:
+		return struct {
+			*statusRecorder
+			http.Pusher
+		}{rw, p}
+	default:
+		return rw
+	}
+}
+
+// recorderFlusher flushes the underlying http.ResponseWriter of a statusRecorder,
+// which must implement http.Flusher
+type recorderFlusher struct {
+	rw *statusRecorder
+}
+
+// Flush sends the status code 200 if not written, as the underlying Flush does
+func (f recorderFlusher) Flush() {
+	f.rw.wroteHeader = true
+	f.rw.ResponseWriter.(http.Flusher).Flush()
+}
@@ -0,0 +1,74 @@
+package metric
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestInstrumentHandler(t *testing.T) {
+	hg := NewHTTPDurationHistogram("http_request_duration_seconds", "test", nil)
+	h := InstrumentHandler(hg, "/users/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+
+	count, err := hg.GetCountValue(labelValues(hg, httpLabels(http.MethodGet, "404", "/users/{id}")))
+	if err != nil || count != 1 {
+		t.Errorf("PBHistogram.GetCountValue() = %v, %v, want %v", count, err, 1)
+	}
+}
+
+func TestInstrumentHandler_Interfaces(t *testing.T) {
+	hg := NewHTTPDurationHistogram("http_request_duration_seconds", "test", nil)
+	var isFlusher, isHijacker, isPusher bool
+	h := InstrumentHandler(hg, "/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, isFlusher = w.(http.Flusher)
+		_, isHijacker = w.(http.Hijacker)
+		_, isPusher = w.(http.Pusher)
+	}))
+
+	// httptest.ResponseRecorder implements http.Flusher only
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if !isFlusher || isHijacker || isPusher {
+		t.Errorf("http.ResponseWriter is Flusher %v, Hijacker %v, Pusher %v, want true, false, false", isFlusher, isHijacker, isPusher)
+	}
+
+	h.ServeHTTP(struct{ http.ResponseWriter }{httptest.NewRecorder()}, httptest.NewRequest(http.MethodGet, "/", nil))
+	if isFlusher {
+		t.Errorf("http.ResponseWriter is Flusher, want not")
+	}
+}
+
+func TestInstrumentHandler_InvalidLabels(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("InstrumentHandler() did not panic")
+		}
+	}()
+	hg := NewPBHistogram("http_request_duration_seconds", "test", []string{"method", "path"}, nil)
+	InstrumentHandler(hg, "/", http.NotFoundHandler())
+}
+
+func TestInstrumentRoundTripper(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	hg := NewHTTPDurationHistogram("http_client_request_duration_seconds", "test", nil)
+	client := &http.Client{Transport: InstrumentRoundTripper(hg, "/", nil)}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	resp.Body.Close()
+
+	count, err := hg.GetCountValue(labelValues(hg, httpLabels(http.MethodGet, "200", "/")))
+	if err != nil || count != 1 {
+		t.Errorf("PBHistogram.GetCountValue() = %v, %v, want %v", count, err, 1)
+	}
+}
+
+func labelValues(hg *PBHistogram, labels map[string]string) []string {
+	lvs, _ := hg.count.labelValues(labels)
+	return lvs
+}
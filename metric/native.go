@@ -0,0 +1,115 @@
+package metric
+
+import (
+	"math"
+	"slices"
+
+	"github.com/sq325/remoteWrite/prompb"
+)
+
+// valid exponential schemas of native histograms
+const (
+	minNativeSchema = -4
+	maxNativeSchema = 8
+)
+
+// nativeIndex returns the index of the exponential bucket of schema containing v > 0,
+// bucket i covers (base^(i-1), base^i] where base = 2^(2^-schema)
+func nativeIndex(v float64, schema int32) int32 {
+	frac, exp := math.Frexp(v) // v = frac * 2^exp, frac in [0.5, 1)
+	if frac == 0.5 {
+		// v is a power of 2, it is the upper bound of its bucket
+		exp--
+		frac = 1
+	}
+	if schema <= 0 {
+		// buckets are wider than a power of 2, v is within (2^(exp-1), 2^exp]
+		div := int32(1) << -schema
+		idx := int32(exp)
+		// ceil division
+		q := idx / div
+		if idx%div != 0 && idx > 0 {
+			q++
+		}
+		return q
+	}
+	return int32(math.Ceil(math.Log2(frac)*math.Exp2(float64(schema)))) + int32(exp)<<schema
+}
+
+// classicToNative maps the classic buckets to a float native histogram of the exponential schema.
+// les and bvs are the finite upper bounds and cumulative values, inf is the +Inf bucket value, see cumulative.
+// The observations of a classic bucket are put into the native bucket containing its upper bound,
+// the observations above the highest finite upper bound are put into the next native bucket,
+// so the result approximates the distribution within the resolution of the classic buckets.
+func classicToNative(les, bvs []float64, inf, sum float64, schema int32, timestamp int64) *prompb.Histogram {
+	var (
+		positive = map[int32]float64{}
+		negative = map[int32]float64{}
+		zero     float64
+		prev     float64
+	)
+	put := func(v, count float64) {
+		switch {
+		case count == 0:
+		case v > 0:
+			positive[nativeIndex(v, schema)] += count
+		case v < 0:
+			negative[nativeIndex(-v, schema)] += count
+		default:
+			zero += count
+		}
+	}
+	for i, le := range les {
+		put(le, bvs[i]-prev)
+		prev = bvs[i]
+	}
+	if n := len(les); n > 0 && les[n-1] > 0 {
+		positive[nativeIndex(les[n-1], schema)+1] += inf - prev
+	} else {
+		zero += inf - prev
+	}
+
+	ph := &prompb.Histogram{
+		Count:     &prompb.Histogram_CountFloat{CountFloat: inf},
+		Sum:       sum,
+		Schema:    schema,
+		ZeroCount: &prompb.Histogram_ZeroCountFloat{ZeroCountFloat: zero},
+		Timestamp: timestamp,
+	}
+	ph.PositiveSpans, ph.PositiveCounts = nativeBuckets(positive)
+	ph.NegativeSpans, ph.NegativeCounts = nativeBuckets(negative)
+	return ph
+}
+
+// nativeBuckets encodes the buckets of index -> count to spans and absolute counts, empty buckets are skipped
+func nativeBuckets(buckets map[int32]float64) ([]*prompb.BucketSpan, []float64) {
+	idxs := make([]int32, 0, len(buckets))
+	for idx, count := range buckets {
+		if count != 0 {
+			idxs = append(idxs, idx)
+		}
+	}
+	if len(idxs) == 0 {
+		return nil, nil
+	}
+	slices.Sort(idxs)
+
+	var (
+		spans  []*prompb.BucketSpan
+		counts = make([]float64, 0, len(idxs))
+		next   int32 // index following the last span
+	)
+	for i, idx := range idxs {
+		if i == 0 || idx != next {
+			offset := idx
+			if i > 0 {
+				offset = idx - next
+			}
+			spans = append(spans, &prompb.BucketSpan{Offset: offset})
+		}
+		spans[len(spans)-1].Length++
+		counts = append(counts, buckets[idx])
+		next = idx + 1
+	}
+	return spans, counts
+}
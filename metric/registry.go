@@ -0,0 +1,283 @@
+package metric
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sq325/remoteWrite/prompb"
+)
+
+var (
+	// DefaultRegistry is the global Registry used by the package level Register, MustRegister, Unregister and Gather
+	DefaultRegistry = NewRegistry()
+
+	ErrConflictingMetric = errors.New("conflicting metric")
+)
+
+// AlreadyRegisteredError is returned by Register if the metric to register
+// has been registered before, or an identical metric with the same name, labels and const label values
+// has been registered. ExistingMetric can be used to continue using the registered one.
+type AlreadyRegisteredError struct {
+	ExistingMetric, NewMetric PBMetric
+}
+
+func (err AlreadyRegisteredError) Error() string {
+	return "duplicate metrics registration attempted"
+}
+
+// Registry registers PBMetrics and gathers their TimeSeries.
+// PBMetrics implementing PBDescriber are checked for conflicting names and label schemas,
+// other PBMetrics are registered unchecked.
+// PBMetrics must be comparable, e.g. pointers.
+// Registry is safe for concurrent use.
+// Registry implements prometheus.Collector, so it can be registered with a prometheus.Registry and served via promhttp.
+type Registry struct {
+	mtx     sync.RWMutex
+	metrics []PBMetric              // in order of registration
+	descs   map[string][]registered // series name -> registered Descs, one for each const label values
+}
+
+// registered is a registered Desc and the PBMetric describing it
+type registered struct {
+	desc  *Desc
+	owner PBMetric
+}
+
+var _ prometheus.Collector = (*Registry)(nil)
+
+func NewRegistry() *Registry {
+	return &Registry{
+		metrics: []PBMetric{},
+		descs:   map[string][]registered{},
+	}
+}
+
+// Register registers a PBMetric.
+// Metrics of the same name are allowed if they differ in const label values, e.g. service="a" and service="b",
+// and have the same type, help and label names.
+// Return AlreadyRegisteredError if m or an identical metric is already registered,
+// and an error wrapping ErrConflictingMetric if a series name is already used with a different type, help or label names.
+func (r *Registry) Register(m PBMetric) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if slices.Contains(r.metrics, m) {
+		return AlreadyRegisteredError{ExistingMetric: m, NewMetric: m}
+	}
+
+	d, ok := m.(PBDescriber)
+	if !ok {
+		r.metrics = append(r.metrics, m)
+		return nil
+	}
+
+	seen := map[string]struct{}{}
+	for _, desc := range d.Descs() {
+		if desc == nil || desc.Name == "" {
+			return fmt.Errorf("%w: empty metric name", ErrConflictingMetric)
+		}
+		if !isUnique(desc.Labels) {
+			return fmt.Errorf("%w: duplicate label names %v in metric %s", ErrConflictingMetric, desc.Labels, desc.Name)
+		}
+		for _, name := range seriesNames(desc) {
+			if _, ok := seen[name]; ok {
+				return fmt.Errorf("%w: series name %s is generated twice", ErrConflictingMetric, name)
+			}
+			seen[name] = struct{}{}
+
+			for _, e := range r.descs[name] {
+				existing := e.desc
+				if existing.Type != desc.Type || !sameLabelNames(existing, desc) {
+					return fmt.Errorf("%w: series name %s is already registered with type %s and labels %v %v, got type %s and labels %v %v",
+						ErrConflictingMetric, name, existing.Type, existing.Labels, existing.ConstLabels, desc.Type, desc.Labels, desc.ConstLabels)
+				}
+				if maps.Equal(existing.ConstLabels, desc.ConstLabels) {
+					return AlreadyRegisteredError{ExistingMetric: e.owner, NewMetric: m}
+				}
+				if existing.Help != desc.Help {
+					return fmt.Errorf("%w: series name %s is already registered with help %q, got help %q",
+						ErrConflictingMetric, name, existing.Help, desc.Help)
+				}
+			}
+		}
+	}
+
+	for _, desc := range d.Descs() {
+		for _, name := range seriesNames(desc) {
+			r.descs[name] = append(r.descs[name], registered{desc: desc, owner: m})
+		}
+	}
+	r.metrics = append(r.metrics, m)
+	return nil
+}
+
+// MustRegister registers the PBMetrics and panics if any error occurs
+func (r *Registry) MustRegister(ms ...PBMetric) {
+	for _, m := range ms {
+		if err := r.Register(m); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Unregister unregisters a PBMetric, return whether the PBMetric was registered
+func (r *Registry) Unregister(m PBMetric) bool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	i := slices.Index(r.metrics, m)
+	if i < 0 {
+		return false
+	}
+	r.metrics = slices.Delete(r.metrics, i, i+1)
+	for name, es := range r.descs {
+		es = slices.DeleteFunc(es, func(e registered) bool { return e.owner == m })
+		if len(es) == 0 {
+			delete(r.descs, name)
+		} else {
+			r.descs[name] = es
+		}
+	}
+	return true
+}
+
+// Gather returns the TimeSeries of all registered PBMetrics
+// timestamp: timestamp is in ms format
+func (r *Registry) Gather(timestamp int64) []*prompb.TimeSeries {
+	r.mtx.RLock()
+	metrics := slices.Clone(r.metrics)
+	r.mtx.RUnlock()
+
+	var tsList []*prompb.TimeSeries
+	for _, m := range metrics {
+		tsList = append(tsList, m.TimeSeries(timestamp)...)
+	}
+	return tsList
+}
+
+// Metadata returns the MetricMetadata of all registered PBDescribers
+func (r *Registry) Metadata() []*prompb.MetricMetadata {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	var mds []*prompb.MetricMetadata
+	for _, m := range r.metrics {
+		d, ok := m.(PBDescriber)
+		if !ok {
+			continue
+		}
+		for _, desc := range d.Descs() {
+			mds = append(mds, &prompb.MetricMetadata{
+				Type:             desc.Type,
+				MetricFamilyName: desc.Name,
+				Help:             desc.Help,
+			})
+		}
+	}
+	return mds
+}
+
+// Implement prometheus.Collector interface
+// Only the registered PBMetrics implementing prometheus.Collector are described
+func (r *Registry) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range r.collectors() {
+		c.Describe(ch)
+	}
+}
+
+// Implement prometheus.Collector interface
+// Only the registered PBMetrics implementing prometheus.Collector are collected
+func (r *Registry) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range r.collectors() {
+		c.Collect(ch)
+	}
+}
+
+func (r *Registry) collectors() []prometheus.Collector {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	cs := make([]prometheus.Collector, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		if c, ok := m.(prometheus.Collector); ok {
+			cs = append(cs, c)
+		}
+	}
+	return cs
+}
+
+// Register registers the PBMetric with the DefaultRegistry
+func Register(m PBMetric) error {
+	return DefaultRegistry.Register(m)
+}
+
+// MustRegister registers the PBMetrics with the DefaultRegistry and panics if any error occurs
+func MustRegister(ms ...PBMetric) {
+	DefaultRegistry.MustRegister(ms...)
+}
+
+// Unregister unregisters the PBMetric from the DefaultRegistry
+func Unregister(m PBMetric) bool {
+	return DefaultRegistry.Unregister(m)
+}
+
+// Gather returns the TimeSeries of all PBMetrics registered with the DefaultRegistry
+func Gather(timestamp int64) []*prompb.TimeSeries {
+	return DefaultRegistry.Gather(timestamp)
+}
+
+// RegisterInternalMetrics registers the counters of the package itself with reg, e.g. prometheus.DefaultRegisterer:
+// SeriesOverflowCounter, HistogramRepairCounter and BufferDroppedCounter.
+// The counters already registered with reg are skipped.
+func RegisterInternalMetrics(reg prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{SeriesOverflowCounter, HistogramRepairCounter, BufferDroppedCounter} {
+		if err := reg.Register(c); err != nil {
+			var are prometheus.AlreadyRegisteredError
+			if errors.As(err, &are) {
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// seriesNames returns all the __name__ values a metric family generates
+func seriesNames(desc *Desc) []string {
+	switch desc.Type {
+	case prompb.MetricMetadata_HISTOGRAM, prompb.MetricMetadata_GAUGEHISTOGRAM:
+		return []string{desc.Name, desc.Name + "_bucket", desc.Name + "_sum", desc.Name + "_count"}
+	case prompb.MetricMetadata_SUMMARY:
+		return []string{desc.Name, desc.Name + "_sum", desc.Name + "_count"}
+	default:
+		return []string{desc.Name}
+	}
+}
+
+// sameLabelNames returns whether a and b have the same variable labels and const label names
+func sameLabelNames(a, b *Desc) bool {
+	if !slices.Equal(a.Labels, b.Labels) || len(a.ConstLabels) != len(b.ConstLabels) {
+		return false
+	}
+	for name := range a.ConstLabels {
+		if _, ok := b.ConstLabels[name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func isUnique(ss []string) bool {
+	seen := make(map[string]struct{}, len(ss))
+	for _, s := range ss {
+		if _, ok := seen[s]; ok {
+			return false
+		}
+		seen[s] = struct{}{}
+	}
+	return true
+}
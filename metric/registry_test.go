@@ -0,0 +1,187 @@
+package metric
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRegistry_Register(t *testing.T) {
+	counter := NewPBCounter("test_total", "test", []string{"label1"})
+	hg := NewPBHistogram("test_histogram", "test", []string{"label1"}, []float64{1, 2})
+
+	tests := []struct {
+		name       string
+		metric     PBMetric
+		wantErr    error
+		wantExists bool
+	}{
+		{
+			name:   "counter",
+			metric: counter,
+		},
+		{
+			name:   "histogram",
+			metric: hg,
+		},
+		{
+			name:       "same instance",
+			metric:     counter,
+			wantExists: true,
+		},
+		{
+			name:       "identical counter",
+			metric:     NewPBCounter("test_total", "other help", []string{"label1"}),
+			wantExists: true,
+		},
+		{
+			name:    "different labels",
+			metric:  NewPBCounter("test_total", "test", []string{"label2"}),
+			wantErr: ErrConflictingMetric,
+		},
+		{
+			name:    "histogram series name",
+			metric:  NewPBCounter("test_histogram_count", "test", []string{"label1"}),
+			wantErr: ErrConflictingMetric,
+		},
+		{
+			name:    "histogram type",
+			metric:  NewPBHistogram("test_total", "test", []string{"label1"}, nil),
+			wantErr: ErrConflictingMetric,
+		},
+	}
+
+	r := NewRegistry()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := r.Register(tt.metric)
+			var are AlreadyRegisteredError
+			if tt.wantExists {
+				if !errors.As(err, &are) {
+					t.Fatalf("Registry.Register() error = %v, want AlreadyRegisteredError", err)
+				}
+				if are.ExistingMetric != counter {
+					t.Errorf("AlreadyRegisteredError.ExistingMetric = %v, want %v", are.ExistingMetric, counter)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Registry.Register() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRegistry_RegisterConstLabels(t *testing.T) {
+	newCounter := func(help string, constLabels prometheus.Labels) *PBCounter {
+		return NewPBCounter("test_total", help, []string{"label1"}, WithConstLabels(constLabels))
+	}
+	r := NewRegistry()
+	a := newCounter("test", prometheus.Labels{"service": "a"})
+	r.MustRegister(a)
+
+	if err := r.Register(newCounter("test", prometheus.Labels{"service": "b"})); err != nil {
+		t.Errorf("Registry.Register() other const label values error = %v", err)
+	}
+	var are AlreadyRegisteredError
+	if err := r.Register(newCounter("test", prometheus.Labels{"service": "a"})); !errors.As(err, &are) || are.ExistingMetric != a {
+		t.Errorf("Registry.Register() same const label values error = %v, want AlreadyRegisteredError", err)
+	}
+	if err := r.Register(newCounter("other help", prometheus.Labels{"service": "c"})); !errors.Is(err, ErrConflictingMetric) {
+		t.Errorf("Registry.Register() other help error = %v, want %v", err, ErrConflictingMetric)
+	}
+	if err := r.Register(newCounter("test", prometheus.Labels{"region": "c"})); !errors.Is(err, ErrConflictingMetric) {
+		t.Errorf("Registry.Register() other const label names error = %v, want %v", err, ErrConflictingMetric)
+	}
+
+	// b is still registered after a is unregistered
+	r.Unregister(a)
+	if err := r.Register(newCounter("test", prometheus.Labels{"service": "b"})); !errors.As(err, &are) {
+		t.Errorf("Registry.Register() after Unregister error = %v, want AlreadyRegisteredError", err)
+	}
+}
+
+func TestRegistry_Gather(t *testing.T) {
+	r := NewRegistry()
+	counter := NewPBCounter("test_total", "test", []string{"label1"})
+	hg := NewPBHistogram("test_histogram", "test", []string{"label1"}, []float64{1, 2})
+	r.MustRegister(counter, hg)
+
+	counter.Inc([]string{"value1"})
+	hg.Observe([]string{"value1"}, 1)
+
+	if got := len(r.Gather(1722838400634)); got != 6 {
+		t.Errorf("len(Registry.Gather()) = %d, want %d", got, 6)
+	}
+	if got := len(r.Metadata()); got != 2 {
+		t.Errorf("len(Registry.Metadata()) = %d, want %d", got, 2)
+	}
+
+	if !r.Unregister(counter) {
+		t.Errorf("Registry.Unregister() = false, want true")
+	}
+	if r.Unregister(counter) {
+		t.Errorf("Registry.Unregister() = true, want false")
+	}
+	if err := r.Register(NewPBCounter("test_total", "test", []string{"label2"})); err != nil {
+		t.Errorf("Registry.Register() after Unregister error = %v", err)
+	}
+}
+
+func TestRegistry_Collect(t *testing.T) {
+	r := NewRegistry()
+	counter := NewPBCounter("test_total", "test", []string{"label1"})
+	hg := NewPBHistogram("test_histogram", "test", []string{"label1"}, []float64{1, 2})
+	r.MustRegister(counter, hg)
+
+	counter.Add([]string{"value1"}, 2)
+	hg.Add([]string{"value1"}, 1, 1)
+	hg.Add([]string{"value1"}, 2, 2)
+	hg.AddCount([]string{"value1"}, 3)
+	hg.AddSum([]string{"value1"}, 4)
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(r)
+
+	want := `
+# HELP test_histogram test
+# TYPE test_histogram histogram
+test_histogram_bucket{label1="value1",le="1"} 1
+test_histogram_bucket{label1="value1",le="2"} 2
+test_histogram_bucket{label1="value1",le="+Inf"} 3
+test_histogram_sum{label1="value1"} 4
+test_histogram_count{label1="value1"} 3
+# HELP test_total test
+# TYPE test_total counter
+test_total{label1="value1"} 2
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRegisterInternalMetrics(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	for i := 0; i < 2; i++ {
+		if err := RegisterInternalMetrics(reg); err != nil {
+			t.Fatalf("RegisterInternalMetrics() error = %v", err)
+		}
+	}
+	if _, err := reg.Gather(); err != nil {
+		t.Errorf("Registry.Gather() error = %v", err)
+	}
+}
+
+func TestRegistry_RegisterCreatedSeries(t *testing.T) {
+	r := NewRegistry()
+	r.MustRegister(NewPBCounter("x_total", "test", []string{"label1"}, WithCreatedSeries()))
+	if got := len(r.Metadata()); got != 2 {
+		t.Errorf("len(Registry.Metadata()) = %d, want %d", got, 2)
+	}
+	if err := r.Register(NewGaugeFunc("x_created", "test", func() float64 { return 1 })); !errors.Is(err, ErrConflictingMetric) {
+		t.Errorf("Registry.Register() error = %v, want %v", err, ErrConflictingMetric)
+	}
+}
@@ -0,0 +1,141 @@
+package metric
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+)
+
+// Bucket is a cumulative bucket of a histogram
+type Bucket struct {
+	UpperBound float64
+	Count      float64 // number of observations <= UpperBound
+}
+
+// HistogramSnapshot is the state of a PBHistogram with specific label values
+type HistogramSnapshot struct {
+	LabelValues []string // not include bucket_label
+	Buckets     []Bucket // cumulative, sorted by UpperBound, the last one is +Inf
+	Count       float64  // same as the +Inf bucket
+	Sum         float64
+}
+
+// Snapshot returns the state of the label values, lvs not include bucket_label.
+// The buckets are repaired to be cumulative as TimeSeries does.
+// A label values not exist has Count 0.
+func (hg *PBHistogram) Snapshot(lvs []string) (*HistogramSnapshot, error) {
+	hg.mtx.Lock()
+	defer hg.mtx.Unlock()
+
+	count, err := hg.count.Value(lvs)
+	if err != nil {
+		return nil, err
+	}
+	sum, err := hg.sum.Value(lvs)
+	if err != nil {
+		return nil, err
+	}
+
+	hv := &histogramValue{lvs: lvs, buckets: map[float64]float64{}, count: count, sum: sum}
+	for _, blvs := range hg.vec.LabelValues() {
+		if !slices.Equal(blvs[:len(blvs)-1], lvs) {
+			continue
+		}
+		le, err := strconv.ParseFloat(blvs[len(blvs)-1], 64)
+		if err != nil || math.IsInf(le, 1) {
+			continue
+		}
+		v, err := hg.vec.Value(blvs)
+		if err != nil {
+			return nil, err
+		}
+		hv.buckets[le] = v
+	}
+
+	les, bvs, inf, _ := hg.cumulative(hv)
+	s := &HistogramSnapshot{
+		LabelValues: slices.Clone(lvs),
+		Buckets:     make([]Bucket, 0, len(les)+1),
+		Count:       inf,
+		Sum:         sum,
+	}
+	for i, le := range les {
+		s.Buckets = append(s.Buckets, Bucket{UpperBound: le, Count: bvs[i]})
+	}
+	s.Buckets = append(s.Buckets, Bucket{UpperBound: math.Inf(1), Count: inf})
+	return s, nil
+}
+
+// Quantile returns the q-quantile (0 <= q <= 1) of the label values, see HistogramSnapshot.Quantile
+func (hg *PBHistogram) Quantile(lvs []string, q float64) (float64, error) {
+	s, err := hg.Snapshot(lvs)
+	if err != nil {
+		return 0, err
+	}
+	return s.Quantile(q), nil
+}
+
+// Mean returns the average of the observations of the label values, NaN if there is no observation
+func (hg *PBHistogram) Mean(lvs []string) (float64, error) {
+	s, err := hg.Snapshot(lvs)
+	if err != nil {
+		return 0, err
+	}
+	return s.Mean(), nil
+}
+
+// Mean returns Sum / Count, NaN if Count is 0
+func (s *HistogramSnapshot) Mean() float64 {
+	if s.Count == 0 {
+		return math.NaN()
+	}
+	return s.Sum / s.Count
+}
+
+// Quantile estimates the q-quantile by linear interpolation within the bucket the quantile falls into,
+// same as histogram_quantile of PromQL:
+// the lowest bucket is assumed to start at 0 if its upper bound is positive,
+// the upper bound of the highest finite bucket is returned if the quantile falls into the +Inf bucket,
+// NaN is returned if there is no observation or no finite bucket,
+// -Inf is returned for q < 0 and +Inf for q > 1.
+func (s *HistogramSnapshot) Quantile(q float64) float64 {
+	switch {
+	case math.IsNaN(q):
+		return math.NaN()
+	case q < 0:
+		return math.Inf(-1)
+	case q > 1:
+		return math.Inf(1)
+	}
+
+	buckets := s.Buckets
+	if len(buckets) < 2 || !math.IsInf(buckets[len(buckets)-1].UpperBound, 1) {
+		return math.NaN()
+	}
+	observations := buckets[len(buckets)-1].Count
+	if observations == 0 {
+		return math.NaN()
+	}
+
+	rank := q * observations
+	b := sort.Search(len(buckets)-1, func(i int) bool { return buckets[i].Count >= rank })
+	switch {
+	case b == len(buckets)-1:
+		return buckets[len(buckets)-2].UpperBound
+	case b == 0 && buckets[0].UpperBound <= 0:
+		return buckets[0].UpperBound
+	}
+
+	var (
+		start = 0.0
+		end   = buckets[b].UpperBound
+		count = buckets[b].Count
+	)
+	if b > 0 {
+		start = buckets[b-1].UpperBound
+		count -= buckets[b-1].Count
+		rank -= buckets[b-1].Count
+	}
+	return start + (end-start)*(rank/count)
+}
@@ -0,0 +1,31 @@
+package metric
+
+import (
+	"math"
+
+	"github.com/sq325/remoteWrite/prompb"
+)
+
+// staleNaNBits is the bit pattern of the Prometheus staleness marker
+const staleNaNBits = 0x7ff0000000000002
+
+// StaleNaN is the value of a staleness marker sample, it marks the series as stale in Prometheus
+var StaleNaN = math.Float64frombits(staleNaNBits)
+
+// IsStaleNaN reports whether f is a staleness marker
+func IsStaleNaN(f float64) bool {
+	return math.Float64bits(f) == staleNaNBits
+}
+
+// staleTimeSeries generates a TimeSeries with a single staleness marker sample
+func staleTimeSeries(name string, labels, lvs []string, constLabels map[string]string, timestamp int64) *prompb.TimeSeries {
+	return &prompb.TimeSeries{
+		Labels: prompbLabels(name, labels, lvs, constLabels),
+		Samples: []*prompb.Sample{
+			{
+				Value:     StaleNaN,
+				Timestamp: timestamp,
+			},
+		},
+	}
+}
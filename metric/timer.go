@@ -0,0 +1,60 @@
+package metric
+
+import (
+	"time"
+)
+
+// Observer is a metric which observes values, e.g. PBHistogram
+type Observer interface {
+	Observe(lvs []string, value float64)
+}
+
+// Timer observes the duration since it is created, e.g.
+//
+//	defer NewTimer(hg, []string{"GET"}).ObserveDuration()
+type Timer struct {
+	o     Observer
+	lvs   []string
+	unit  time.Duration
+	now   func() time.Time
+	start time.Time
+}
+
+// NewTimer starts a Timer observing into o with the label values lvs.
+// The duration is observed in the unit of o if o has a DurationUnit method, see WithDurationUnit,
+// otherwise in ms as the default of WithDurationUnit.
+func NewTimer(o Observer, lvs []string) *Timer {
+	t := &Timer{
+		o:    o,
+		lvs:  lvs,
+		unit: time.Millisecond,
+		now:  time.Now,
+	}
+	if u, ok := o.(interface{ DurationUnit() time.Duration }); ok {
+		t.unit = u.DurationUnit()
+	}
+	if hg, ok := o.(*PBHistogram); ok {
+		t.now = hg.cfg.now
+	}
+	t.start = t.now()
+	return t
+}
+
+// ObserveDuration observes the duration since the Timer is created, and returns it
+func (t *Timer) ObserveDuration() time.Duration {
+	d := t.now().Sub(t.start)
+	t.o.Observe(t.lvs, float64(d)/float64(t.unit))
+	return d
+}
+
+// DurationUnit returns the unit of the durations observed by Timer and Time
+func (hg *PBHistogram) DurationUnit() time.Duration {
+	return hg.cfg.DurationUnit
+}
+
+// Time calls f and observes its duration, see NewTimer
+func (hg *PBHistogram) Time(lvs []string, f func()) {
+	t := NewTimer(hg, lvs)
+	defer t.ObserveDuration()
+	f()
+}
@@ -0,0 +1,24 @@
+package metric
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPBHistogram_Time(t *testing.T) {
+	now := time.Unix(0, 0)
+	hg := NewPBHistogram("test_histogram", "test", []string{"label1"}, []float64{100, 1000}) // ms by default
+	hg.cfg.now = func() time.Time { return now }
+
+	hg.Time([]string{"a"}, func() { now = now.Add(250 * time.Millisecond) })
+	timer := NewTimer(hg, []string{"a"})
+	now = now.Add(50 * time.Millisecond)
+	if d := timer.ObserveDuration(); d != 50*time.Millisecond {
+		t.Errorf("Timer.ObserveDuration() = %v, want %v", d, 50*time.Millisecond)
+	}
+
+	s, err := hg.Snapshot([]string{"a"})
+	if err != nil || s.Count != 2 || s.Sum != 300 || s.Buckets[0].Count != 1 {
+		t.Errorf("PBHistogram.Snapshot() = %+v, %v", s, err)
+	}
+}
@@ -1,7 +1,83 @@
 package metric
 
-import "github.com/sq325/remoteWrite/prompb"
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/prometheus/common/model"
+	"github.com/sq325/remoteWrite/prompb"
+)
+
+var ErrInvalidName = errors.New("invalid metric or label name")
 
 type PBMetric interface {
 	TimeSeries(timestamp int64) []*prompb.TimeSeries
 }
+
+// Desc describes a metric family generated by a PBMetric
+type Desc struct {
+	Name   string // metric family name, e.g. http_requests_total, or the histogram name without _bucket suffix
+	Help   string
+	Type   prompb.MetricMetadata_MetricType
+	Labels []string // variable labels, not include __name__ and bucket_label
+
+	ConstLabels map[string]string // labels with fixed values, see WithConstLabels
+}
+
+// PBDescriber is a PBMetric which can describe the metric families it generates.
+// Registry uses Descs to detect conflicting metrics.
+type PBDescriber interface {
+	PBMetric
+	Descs() []*Desc
+}
+
+// ValidateDesc validates the metric name and label names.
+// Names are validated according to model.NameValidationScheme,
+// set it to model.UTF8Validation to allow the UTF-8 names of Prometheus 3.
+// Label names must be unique and must not start with "__", which is reserved.
+func ValidateDesc(name string, labels []string) error {
+	if !model.IsValidMetricName(model.LabelValue(name)) {
+		return fmt.Errorf("%w: metric name %q", ErrInvalidName, name)
+	}
+	for i, label := range labels {
+		if !model.LabelName(label).IsValid() {
+			return fmt.Errorf("%w: label name %q of %s", ErrInvalidName, label, name)
+		}
+		if strings.HasPrefix(label, model.ReservedLabelPrefix) {
+			return fmt.Errorf("%w: label name %q of %s is reserved", ErrInvalidName, label, name)
+		}
+		if slices.Contains(labels[:i], label) {
+			return fmt.Errorf("%w: duplicate label name %q of %s", ErrInvalidName, label, name)
+		}
+	}
+	return nil
+}
+
+// validateDescWithConstLabels validates the variable and const label names as ValidateDesc,
+// and the const label values must be valid UTF-8
+func validateDescWithConstLabels(name string, labels []string, constLabels map[string]string) error {
+	names := make([]string, 0, len(constLabels))
+	for label := range constLabels {
+		names = append(names, label)
+	}
+	slices.Sort(names)
+	if err := ValidateDesc(name, append(slices.Clip(labels), names...)); err != nil {
+		return err
+	}
+	for _, label := range names {
+		if !utf8.ValidString(constLabels[label]) {
+			return fmt.Errorf("%w: const label %s of %s has value %q", ErrInvalidUTF8, label, name, constLabels[label])
+		}
+	}
+	return nil
+}
+
+// sortLabels sorts labels by name as the remote write spec requires
+func sortLabels(labels []*prompb.Label) {
+	slices.SortFunc(labels, func(a, b *prompb.Label) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+}
@@ -0,0 +1,104 @@
+package metric
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/sq325/remoteWrite/prompb"
+)
+
+func TestValidateDesc(t *testing.T) {
+	tests := []struct {
+		name    string
+		metric  string
+		labels  []string
+		utf8    bool
+		wantErr bool
+	}{
+		{
+			name:   "valid",
+			metric: "http_requests_total",
+			labels: []string{"method", "code"},
+		},
+		{
+			name:    "invalid metric name",
+			metric:  "http.requests.total",
+			wantErr: true,
+		},
+		{
+			name:    "empty metric name",
+			metric:  "",
+			wantErr: true,
+		},
+		{
+			name:    "invalid label name",
+			metric:  "http_requests_total",
+			labels:  []string{"http.method"},
+			wantErr: true,
+		},
+		{
+			name:    "empty label name",
+			metric:  "http_requests_total",
+			labels:  []string{""},
+			wantErr: true,
+		},
+		{
+			name:    "reserved label name",
+			metric:  "http_requests_total",
+			labels:  []string{"__name__"},
+			wantErr: true,
+		},
+		{
+			name:    "duplicate label name",
+			metric:  "http_requests_total",
+			labels:  []string{"method", "method"},
+			wantErr: true,
+		},
+		{
+			name:   "utf8",
+			metric: "http.requests.total",
+			labels: []string{"http.method"},
+			utf8:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.utf8 {
+				model.NameValidationScheme = model.UTF8Validation
+				defer func() { model.NameValidationScheme = model.LegacyValidation }()
+			}
+			err := ValidateDesc(tt.metric, tt.labels)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateDesc() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidName) {
+				t.Errorf("ValidateDesc() error = %v, want ErrInvalidName", err)
+			}
+		})
+	}
+}
+
+func TestTimeSeries_SortedLabels(t *testing.T) {
+	c := NewPBCounter("test_total", "test", []string{"z", "A", "b"})
+	c.Inc([]string{"1", "2", "3"})
+	c.Inc([]string{"1", "", "3"})
+	hg := NewPBHistogram("test_histogram", "test", []string{"z", "A", "m"}, []float64{1})
+	hg.Observe([]string{"1", "2", "3"}, 1)
+
+	var tsList []*prompb.TimeSeries
+	tsList = append(tsList, c.TimeSeries(1)...)
+	tsList = append(tsList, hg.TimeSeries(1)...)
+	for _, ts := range tsList {
+		if !slices.IsSortedFunc(ts.Labels, func(a, b *prompb.Label) int { return strings.Compare(a.Name, b.Name) }) {
+			t.Errorf("labels of %s are not sorted: %v", seriesString(ts), ts.Labels)
+		}
+		for _, l := range ts.Labels {
+			if l.Name == "" || l.Value == "" {
+				t.Errorf("series %s has empty label %v", seriesString(ts), l)
+			}
+		}
+	}
+}
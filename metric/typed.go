@@ -0,0 +1,224 @@
+package metric
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sq325/remoteWrite/prompb"
+)
+
+// label_tag is the struct tag of the label name used by TypedCounter and TypedHistogram
+const label_tag = "label"
+
+// labelFields maps the tagged fields of a struct to label values
+type labelFields struct {
+	labels []string
+	index  [][]int // field index of each label
+}
+
+// newLabelFields reads the label names from the fields of T tagged with `label:"name"`.
+// Supported field kinds are string, bool, int and uint, fields without the tag or tagged with "-" are ignored.
+// newLabelFields panics if T is not a struct or a tagged field is not supported.
+func newLabelFields[T any]() *labelFields {
+	t := reflect.TypeFor[T]()
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Errorf("label type %s is not a struct", t))
+	}
+
+	lf := &labelFields{}
+	for _, f := range reflect.VisibleFields(t) {
+		label, ok := f.Tag.Lookup(label_tag)
+		if !ok || label == "-" {
+			continue
+		}
+		switch f.Type.Kind() {
+		case reflect.String, reflect.Bool,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		default:
+			panic(fmt.Errorf("field %s.%s of kind %s is not supported as label", t, f.Name, f.Type.Kind()))
+		}
+		lf.labels = append(lf.labels, label)
+		lf.index = append(lf.index, f.Index)
+	}
+	return lf
+}
+
+// labelValues returns the label values of the tagged fields of v
+func (lf *labelFields) labelValues(v any) []string {
+	rv := reflect.ValueOf(v)
+	lvs := make([]string, len(lf.index))
+	for i, index := range lf.index {
+		f := rv.FieldByIndex(index)
+		switch f.Kind() {
+		case reflect.String:
+			lvs[i] = f.String()
+		case reflect.Bool:
+			lvs[i] = strconv.FormatBool(f.Bool())
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			lvs[i] = strconv.FormatInt(f.Int(), 10)
+		default:
+			lvs[i] = strconv.FormatUint(f.Uint(), 10)
+		}
+	}
+	return lvs
+}
+
+// TypedCounter is a PBCounter whose label values are given by a struct T,
+// label names are read from the fields of T tagged with `label:"name"`, e.g.
+//
+//	type RequestLabels struct {
+//		Method string `label:"method"`
+//		Code   int    `label:"code"`
+//	}
+//	c := NewTypedCounter[RequestLabels]("http_requests_total", "Total number of HTTP requests")
+//	c.Inc(RequestLabels{Method: "GET", Code: 200})
+//
+// TypedCounter implements PBDescriber and prometheus.Collector
+type TypedCounter[T any] struct {
+	c  *PBCounter
+	lf *labelFields
+}
+
+var (
+	_ PBDescriber          = (*TypedCounter[struct{}])(nil)
+	_ prometheus.Collector = (*TypedCounter[struct{}])(nil)
+)
+
+// NewTypedCounter panics if T is not a struct with supported tagged fields, or the names are invalid
+func NewTypedCounter[T any](name string, help string, opts ...Option) *TypedCounter[T] {
+	lf := newLabelFields[T]()
+	return &TypedCounter[T]{
+		c:  NewPBCounter(name, help, lf.labels, opts...),
+		lf: lf,
+	}
+}
+
+// PBCounter returns the underlying PBCounter
+func (c *TypedCounter[T]) PBCounter() *PBCounter {
+	return c.c
+}
+
+// Errors are logged, use TryAdd to handle them
+func (c *TypedCounter[T]) Add(labels T, value float64) {
+	c.c.Add(c.lf.labelValues(labels), value)
+}
+
+// Errors are logged, use TryInc to handle them
+func (c *TypedCounter[T]) Inc(labels T) {
+	c.c.Inc(c.lf.labelValues(labels))
+}
+
+func (c *TypedCounter[T]) TryAdd(labels T, value float64) error {
+	return c.c.TryAdd(c.lf.labelValues(labels), value)
+}
+
+func (c *TypedCounter[T]) TryInc(labels T) error {
+	return c.c.TryInc(c.lf.labelValues(labels))
+}
+
+func (c *TypedCounter[T]) GetValue(labels T) (float64, error) {
+	return c.c.GetValue(c.lf.labelValues(labels))
+}
+
+// Delete deletes the label values, return whether the label values existed
+func (c *TypedCounter[T]) Delete(labels T) bool {
+	return c.c.Delete(c.lf.labelValues(labels))
+}
+
+// Reset deletes all label values
+func (c *TypedCounter[T]) Reset() {
+	c.c.Reset()
+}
+
+// Implement PBMetric interface
+// timestamp: timestamp is in ms format
+func (c *TypedCounter[T]) TimeSeries(timestamp int64) []*prompb.TimeSeries {
+	return c.c.TimeSeries(timestamp)
+}
+
+// Implement PBDescriber interface
+func (c *TypedCounter[T]) Descs() []*Desc {
+	return c.c.Descs()
+}
+
+// Implement prometheus.Collector interface
+func (c *TypedCounter[T]) Describe(ch chan<- *prometheus.Desc) {
+	c.c.Describe(ch)
+}
+
+// Implement prometheus.Collector interface
+func (c *TypedCounter[T]) Collect(ch chan<- prometheus.Metric) {
+	c.c.Collect(ch)
+}
+
+// TypedHistogram is a PBHistogram whose label values are given by a struct T, see TypedCounter
+// TypedHistogram implements PBDescriber and prometheus.Collector
+type TypedHistogram[T any] struct {
+	hg *PBHistogram
+	lf *labelFields
+}
+
+var (
+	_ PBDescriber          = (*TypedHistogram[struct{}])(nil)
+	_ prometheus.Collector = (*TypedHistogram[struct{}])(nil)
+)
+
+// NewTypedHistogram panics if T is not a struct with supported tagged fields, or the names are invalid
+func NewTypedHistogram[T any](name string, help string, buckets []float64, opts ...Option) *TypedHistogram[T] {
+	lf := newLabelFields[T]()
+	return &TypedHistogram[T]{
+		hg: NewPBHistogram(name, help, lf.labels, buckets, opts...),
+		lf: lf,
+	}
+}
+
+// PBHistogram returns the underlying PBHistogram
+func (hg *TypedHistogram[T]) PBHistogram() *PBHistogram {
+	return hg.hg
+}
+
+// Errors are logged, use TryObserve to handle them
+func (hg *TypedHistogram[T]) Observe(labels T, value float64) {
+	if err := hg.TryObserve(labels, value); err != nil {
+		slog.Error("TypedHistogram.Observe failed", "name", hg.hg.name, "labels", labels, "value", value, "err", err)
+	}
+}
+
+func (hg *TypedHistogram[T]) TryObserve(labels T, value float64) error {
+	return hg.hg.TryObserve(hg.lf.labelValues(labels), value)
+}
+
+// Delete deletes the buckets, count and sum of the label values, return whether the label values existed
+func (hg *TypedHistogram[T]) Delete(labels T) bool {
+	return hg.hg.Delete(hg.lf.labelValues(labels))
+}
+
+// Reset deletes all label values, count and sum
+func (hg *TypedHistogram[T]) Reset() {
+	hg.hg.Reset()
+}
+
+// Implement PBMetric interface
+// timestamp: timestamp is in ms format
+func (hg *TypedHistogram[T]) TimeSeries(timestamp int64) []*prompb.TimeSeries {
+	return hg.hg.TimeSeries(timestamp)
+}
+
+// Implement PBDescriber interface
+func (hg *TypedHistogram[T]) Descs() []*Desc {
+	return hg.hg.Descs()
+}
+
+// Implement prometheus.Collector interface
+func (hg *TypedHistogram[T]) Describe(ch chan<- *prometheus.Desc) {
+	hg.hg.Describe(ch)
+}
+
+// Implement prometheus.Collector interface
+func (hg *TypedHistogram[T]) Collect(ch chan<- prometheus.Metric) {
+	hg.hg.Collect(ch)
+}
@@ -0,0 +1,87 @@
+package metric
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testLabels struct {
+	Method  string `label:"method"`
+	Code    int    `label:"code"`
+	Cached  bool   `label:"cached"`
+	Ignored string
+}
+
+func TestTypedCounter(t *testing.T) {
+	c := NewTypedCounter[testLabels]("http_requests_total", "Total number of HTTP requests")
+	if got, want := c.PBCounter().Labels(), []string{"method", "code", "cached"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("TypedCounter labels = %v, want %v", got, want)
+	}
+
+	c.Inc(testLabels{Method: "GET", Code: 200})
+	c.Add(testLabels{Method: "GET", Code: 200, Ignored: "x"}, 2)
+	c.Inc(testLabels{Method: "POST", Code: 500, Cached: true})
+
+	want := map[string]float64{
+		`http_requests_total{cached="false",code="200",method="GET"}`: 3,
+		`http_requests_total{cached="true",code="500",method="POST"}`: 1,
+	}
+	got := map[string]float64{}
+	for _, ts := range c.TimeSeries(1) {
+		got[seriesString(ts)] = ts.Samples[0].Value
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("TypedCounter.TimeSeries() = %v, want %v", got, want)
+	}
+
+	if !c.Delete(testLabels{Method: "POST", Code: 500, Cached: true}) {
+		t.Errorf("TypedCounter.Delete() = false, want true")
+	}
+	if got, err := c.GetValue(testLabels{Method: "POST", Code: 500, Cached: true}); err != nil || got != 0 {
+		t.Errorf("TypedCounter.GetValue() of deleted labels = %v, %v, want %v", got, err, 0)
+	}
+}
+
+func TestTypedHistogram(t *testing.T) {
+	type labels struct {
+		Path string `label:"path"`
+	}
+	hg := NewTypedHistogram[labels]("test_histogram", "Test Histogram", []float64{1})
+	hg.Observe(labels{Path: "/"}, 0.5)
+	hg.PBHistogram().ObserveWith(map[string]string{"path": "/"}, 2)
+
+	count, err := hg.PBHistogram().GetCountValue([]string{"/"})
+	if err != nil || count != 2 {
+		t.Errorf("PBHistogram.GetCountValue() = %v, %v, want %v", count, err, 2)
+	}
+}
+
+func TestNewTypedCounter_Panic(t *testing.T) {
+	tests := []struct {
+		name string
+		new  func()
+	}{
+		{
+			name: "not a struct",
+			new:  func() { NewTypedCounter[string]("test", "test") },
+		},
+		{
+			name: "unsupported field",
+			new: func() {
+				NewTypedCounter[struct {
+					F float64 `label:"f"`
+				}]("test", "test")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewTypedCounter() did not panic")
+				}
+			}()
+			tt.new()
+		})
+	}
+}
@@ -2,12 +2,48 @@ package metric
 
 import (
 	"errors"
-	"reflect"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 
 	"github.com/prometheus/client_golang/prometheus"
 	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+	"github.com/sq325/remoteWrite/prompb"
 )
 
+var (
+	ErrUnsupportedMetric   = errors.New("unsupported metric type, only Gauge and Counter are supported")
+	ErrLabelValuesMismatch = errors.New("labels and labelvalues not match")
+	ErrNegativeValue       = errors.New("counter cannot decrease in value")
+	ErrInvalidUTF8         = errors.New("label value is not valid UTF-8")
+	ErrMaxSeries           = errors.New("max series limit hit")
+	ErrInvalidValue        = errors.New("value is NaN or infinite")
+)
+
+// OverflowLabelValue is the label value of the overflow series, see WithMaxSeries
+const OverflowLabelValue = "__overflow__"
+
+// SeriesOverflowCounter counts the distinct label values folded into the overflow series, see WithMaxSeries.
+// The count is approximate, the rejected label values are remembered by a fixed size bitmap of their hashes
+// to keep the memory bounded, so label values sharing a bit are counted once.
+// Register it with RegisterInternalMetrics.
+var SeriesOverflowCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "remotewrite_metric_series_overflow_total",
+		Help: "Approximate number of distinct label values folded into the overflow series because the max series limit of the metric was hit",
+	},
+	[]string{"name"},
+)
+
+// overflowBits is the number of bits of the bitmap remembering the rejected label values of a Vec, 8KiB
+const overflowBits = 1 << 16
+
 // Valuer is a getter to get the value of a metric
 type Valuer interface {
 	GetValue() float64
@@ -43,7 +79,7 @@ func (c counterValuer) GetValue() float64 {
 func GetMetricValue(pm prometheus.Metric) (float64, error) {
 	m := NewValuer(pm)
 	if m == nil {
-		return 0, errors.New("unsupported metric type, only Gauge and Counter are supported")
+		return 0, ErrUnsupportedMetric
 	}
 	return m.GetValue(), nil
 }
@@ -54,20 +90,47 @@ type IVec interface {
 }
 
 // Vec implement IVec interface
+// Vec is safe for concurrent use
 type Vec struct {
-	name        string // metric name
-	labels      []string
-	labelvalues [][]string
-	vec         IVec
+	name   string // metric name
+	labels []string
+	vec    IVec
+	cfg    *config
+
+	mtx    sync.RWMutex
+	series []*series            // in order of creation
+	index  map[uint64][]*series // hash of label values -> series, slice for hash collision
+	stale  [][]string           // deleted label values waiting for staleness markers
+
+	overflowed []atomic.Uint64 // bitmap of the hashes of the rejected label values, only allocated if WithMaxSeries is set
+
+	lastPush atomic.Int64 // timestamp in ms of the last TimeSeries call, see WithCreatedZeroSamples
+}
+
+// series is a label values of Vec and the corresponding metric of the underlying IVec
+type series struct {
+	lvs     []string
+	m       prometheus.Metric
+	created int64        // unix nano of the creation
+	updated atomic.Int64 // unix nano of the last update, only maintained if WithTTL is set
 }
 
-func NewVec(name string, labels []string, vec IVec) *Vec {
-	return &Vec{
-		name:        name,
-		labels:      labels,
-		labelvalues: [][]string{},
-		vec:         vec,
+// name is prefixed by WithNamespace and WithSubsystem, WithConstLabels are added to the TimeSeries,
+// vec should be created with the same fully qualified name and const labels to be collected consistently
+func NewVec(name string, labels []string, vec IVec, opts ...Option) *Vec {
+	cfg := newConfig(opts...)
+	v := &Vec{
+		name:   cfg.fqName(name),
+		labels: labels,
+		vec:    vec,
+		cfg:    cfg,
+		series: []*series{},
+		index:  map[uint64][]*series{},
 	}
+	if cfg.MaxSeries > 0 {
+		v.overflowed = make([]atomic.Uint64, overflowBits/64)
+	}
+	return v
 }
 
 func (v *Vec) Name() string {
@@ -78,93 +141,572 @@ func (v *Vec) Labels() []string {
 	return v.labels
 }
 
+// LabelValues returns the label values in order of creation
+// The returned label values must not be modified
 func (v *Vec) LabelValues() [][]string {
-	return v.labelvalues
+	v.mtx.RLock()
+	defer v.mtx.RUnlock()
+
+	lvsList := make([][]string, 0, len(v.series))
+	for _, s := range v.series {
+		lvsList = append(lvsList, s.lvs)
+	}
+	return lvsList
 }
 
+// Set sets the gauge to value, or adds value to the counter
+// Errors are logged, use TrySet to handle them
 func (v *Vec) Set(labelvalues []string, value float64) {
-	switch any(v.vec).(type) {
-	case *counterVec:
-		any(v.vec).(*counterVec).cv.WithLabelValues(labelvalues...).Add(value)
-	case *gaugeVec:
-		any(v.vec).(*gaugeVec).gv.WithLabelValues(labelvalues...).Set(value)
+	if err := v.TrySet(labelvalues, value); err != nil {
+		slog.Error("Vec.Set failed", "name", v.name, "labelvalues", labelvalues, "value", value, "err", err)
 	}
+}
 
-	var exist bool
-	for _, lv := range v.labelvalues {
-		if reflect.DeepEqual(lv, labelvalues) {
-			exist = true
-			break
+// Errors are logged, use TryAdd to handle them
+func (v *Vec) Add(labelvalues []string, value float64) {
+	if err := v.TryAdd(labelvalues, value); err != nil {
+		slog.Error("Vec.Add failed", "name", v.name, "labelvalues", labelvalues, "value", value, "err", err)
+	}
+}
+
+// Errors are logged, use TryInc to handle them
+func (v *Vec) Inc(labelvalues []string) {
+	if err := v.TryInc(labelvalues); err != nil {
+		slog.Error("Vec.Inc failed", "name", v.name, "labelvalues", labelvalues, "err", err)
+	}
+}
+
+// TrySet is like Set but returns an error instead of logging it
+// The value is checked before the label values is created, so a rejected value creates no series.
+func (v *Vec) TrySet(labelvalues []string, value float64) error {
+	if _, ok := v.vec.(*counterVec); ok {
+		if err := checkCounterValue(value); err != nil {
+			return err
+		}
+	}
+	s, err := v.getOrCreateSeries(labelvalues, true)
+	if err != nil {
+		return err
+	}
+	switch m := s.m.(type) {
+	case prometheus.Gauge:
+		m.Set(value)
+	case prometheus.Counter:
+		if err := checkCounterValue(value); err != nil {
+			return err
 		}
+		m.Add(value)
 	}
+	return nil
+}
 
-	if !exist {
-		v.labelvalues = append(v.labelvalues, labelvalues)
+// TryAdd is like Add but returns an error instead of logging it
+// The value is checked before the label values is created, so a rejected value creates no series.
+func (v *Vec) TryAdd(labelvalues []string, value float64) error {
+	if _, ok := v.vec.(*counterVec); ok {
+		if err := checkCounterValue(value); err != nil {
+			return err
+		}
+	}
+	s, err := v.getOrCreateSeries(labelvalues, true)
+	if err != nil {
+		return err
 	}
+	switch m := s.m.(type) {
+	case prometheus.Gauge:
+		m.Add(value)
+	case prometheus.Counter:
+		if err := checkCounterValue(value); err != nil {
+			return err
+		}
+		m.Add(value)
+	}
+	return nil
 }
 
-func (v *Vec) Add(labelvalues []string, value float64) {
-	switch any(v.vec).(type) {
-	case *counterVec:
-		any(v.vec).(*counterVec).cv.WithLabelValues(labelvalues...).Add(value)
-	case *gaugeVec:
-		any(v.vec).(*gaugeVec).gv.WithLabelValues(labelvalues...).Add(value)
+// checkCounterValue checks value can be added to a counter,
+// a NaN or infinite value would stick to the counter for good
+func checkCounterValue(value float64) error {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return fmt.Errorf("%w: %v", ErrInvalidValue, value)
 	}
+	if value < 0 {
+		return fmt.Errorf("%w: %v", ErrNegativeValue, value)
+	}
+	return nil
+}
 
-	var exist bool
-	for _, lv := range v.labelvalues {
-		if reflect.DeepEqual(lv, labelvalues) {
-			exist = true
-			break
+// TryInc is like Inc but returns an error instead of logging it
+func (v *Vec) TryInc(labelvalues []string) error {
+	s, err := v.getOrCreateSeries(labelvalues, true)
+	if err != nil {
+		return err
+	}
+	switch m := s.m.(type) {
+	case prometheus.Gauge:
+		m.Inc()
+	case prometheus.Counter:
+		m.Inc()
+	}
+	return nil
+}
+
+// labelValues returns the label values of labels in the order of v.labels
+// labels must contain exactly the labels of Vec
+func (v *Vec) labelValues(labels prometheus.Labels) ([]string, error) {
+	if len(labels) != len(v.labels) {
+		return nil, fmt.Errorf("%w: %s has labels %v, got %v", ErrLabelValuesMismatch, v.name, v.labels, labels)
+	}
+	lvs := make([]string, len(v.labels))
+	for i, label := range v.labels {
+		lv, ok := labels[label]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s has labels %v, got %v", ErrLabelValuesMismatch, v.name, v.labels, labels)
 		}
+		lvs[i] = lv
 	}
+	return lvs, nil
+}
 
-	if !exist {
-		v.labelvalues = append(v.labelvalues, labelvalues)
+// validateLabelValues checks the number of label values and whether they are valid UTF-8
+func (v *Vec) validateLabelValues(lvs []string) error {
+	if len(lvs) != len(v.labels) {
+		return fmt.Errorf("%w: %s has %d labels %v, got %d label values %q",
+			ErrLabelValuesMismatch, v.name, len(v.labels), v.labels, len(lvs), lvs)
 	}
+	for i, lv := range lvs {
+		if !utf8.ValidString(lv) {
+			return fmt.Errorf("%w: label %s of %s has value %q", ErrInvalidUTF8, v.labels[i], v.name, lv)
+		}
+	}
+	return nil
 }
 
-func (v *Vec) Inc(labelvalues []string) {
-	switch any(v.vec).(type) {
-	case *counterVec:
-		any(v.vec).(*counterVec).cv.WithLabelValues(labelvalues...).Inc()
-	case *gaugeVec:
-		any(v.vec).(*gaugeVec).gv.WithLabelValues(labelvalues...).Inc()
+// getOrCreateSeries returns the series of the label values, and creates it if not exist
+// The series is marked as updated if WithTTL is set
+// overflow: whether to return the overflow series if the max series limit is hit, otherwise ErrMaxSeries is returned
+func (v *Vec) getOrCreateSeries(lvs []string, overflow bool) (*series, error) {
+	s, err := v.getOrCreate(lvs, overflow)
+	if err != nil {
+		return nil, err
+	}
+	if v.cfg.TTL > 0 {
+		s.updated.Store(v.cfg.now().UnixNano())
+	}
+	return s, nil
+}
+
+func (v *Vec) getOrCreate(lvs []string, overflow bool) (*series, error) {
+	h := hashLabelValues(lvs)
+
+	v.mtx.RLock()
+	s := v.lookup(h, lvs)
+	full := v.full()
+	v.mtx.RUnlock()
+	if s != nil {
+		return s, nil
+	}
+	if err := v.validateLabelValues(lvs); err != nil {
+		return nil, err
+	}
+	if full && !overflow {
+		return nil, fmt.Errorf("%w: %s has %d series, got new label values %q", ErrMaxSeries, v.name, v.cfg.MaxSeries, lvs)
+	}
+	if full {
+		// the overflow series usually exists, avoid the write lock
+		olvs := v.overflowLabelValues()
+		v.mtx.RLock()
+		s := v.lookup(hashLabelValues(olvs), olvs)
+		v.mtx.RUnlock()
+		if s != nil {
+			v.countOverflow(h)
+			return s, nil
+		}
+	}
+
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	// check again, the series may be created by another goroutine
+	if s := v.lookup(h, lvs); s != nil {
+		return s, nil
+	}
+	if v.full() {
+		if !overflow {
+			return nil, fmt.Errorf("%w: %s has %d series, got new label values %q", ErrMaxSeries, v.name, v.cfg.MaxSeries, lvs)
+		}
+		v.countOverflow(h)
+		lvs = v.overflowLabelValues()
+		h = hashLabelValues(lvs)
+		if s := v.lookup(h, lvs); s != nil {
+			return s, nil
+		}
+	}
+	m, err := v.vec.GetMetricWithLabelValues(lvs...)
+	if err != nil {
+		return nil, err
 	}
+	s = &series{
+		lvs:     slices.Clone(lvs),
+		m:       m,
+		created: v.cfg.now().UnixNano(),
+	}
+	// set before the series is published, otherwise expire may delete it before the first update
+	if v.cfg.TTL > 0 {
+		s.updated.Store(s.created)
+	}
+	v.series = append(v.series, s)
+	v.index[h] = append(v.index[h], s)
+	// the label values deleted and recreated before the next TimeSeries call is not stale
+	v.stale = slices.DeleteFunc(v.stale, func(x []string) bool { return slices.Equal(x, s.lvs) })
+	return s, nil
+}
 
-	var exist bool
-	for _, lv := range v.labelvalues {
-		if reflect.DeepEqual(lv, labelvalues) {
-			exist = true
-			break
+// countOverflow increments SeriesOverflowCounter if the rejected label values of hash h is not seen before
+func (v *Vec) countOverflow(h uint64) {
+	bit := h % overflowBits
+	word, mask := &v.overflowed[bit/64], uint64(1)<<(bit%64)
+	for {
+		old := word.Load()
+		if old&mask != 0 {
+			return
+		}
+		if word.CompareAndSwap(old, old|mask) {
+			SeriesOverflowCounter.WithLabelValues(v.name).Inc()
+			return
 		}
 	}
+}
 
-	if !exist {
-		v.labelvalues = append(v.labelvalues, labelvalues)
+// full returns whether the max series limit is hit, must be called with v.mtx held
+func (v *Vec) full() bool {
+	return v.cfg.MaxSeries > 0 && len(v.series) >= v.cfg.MaxSeries
+}
+
+// overflowLabelValues returns the label values of the overflow series, all label values are OverflowLabelValue
+func (v *Vec) overflowLabelValues() []string {
+	lvs := make([]string, len(v.labels))
+	for i := range lvs {
+		lvs[i] = OverflowLabelValue
+	}
+	return lvs
+}
+
+// lookup must be called with v.mtx held
+func (v *Vec) lookup(h uint64, lvs []string) *series {
+	for _, s := range v.index[h] {
+		if slices.Equal(s.lvs, lvs) {
+			return s
+		}
 	}
+	return nil
 }
 
 func (v *Vec) GetMetricWithLabelValues(lvs ...string) (prometheus.Metric, error) {
 	return v.vec.GetMetricWithLabelValues(lvs...)
 }
 
+// Value returns the value of the label values, 0 if the label values not exist.
+// Unlike GetMetricWithLabelValues, Value never creates the label values.
+func (v *Vec) Value(lvs []string) (float64, error) {
+	if err := v.validateLabelValues(lvs); err != nil {
+		return 0, err
+	}
+	v.mtx.RLock()
+	s := v.lookup(hashLabelValues(lvs), lvs)
+	v.mtx.RUnlock()
+	if s == nil {
+		return 0, nil
+	}
+	return GetMetricValue(s.m)
+}
+
+// sample is the value of a label values
+type sample struct {
+	lvs     []string
+	value   float64
+	created int64 // unix nano of the creation
+	updated int64 // unix nano of the last update, only maintained if WithTTL is set
+}
+
+// samples returns the value of each label values in order of creation
+func (v *Vec) samples() []sample {
+	v.mtx.RLock()
+	series := slices.Clone(v.series)
+	v.mtx.RUnlock()
+
+	samples := make([]sample, 0, len(series))
+	for _, s := range series {
+		value, err := GetMetricValue(s.m)
+		if err != nil {
+			slog.Error("GetMetricValue failed", "name", v.name, "labelvalues", s.lvs, "err", err)
+			continue
+		}
+		samples = append(samples, sample{lvs: s.lvs, value: value, created: s.created, updated: s.updated.Load()})
+	}
+	return samples
+}
+
+// Implement PBMetric interface
+// A TimeSeries is generated for each label values,
+// and a staleness marker for each label values deleted since the last call if WithStaleMarkers is set,
+// or expired since the last call if WithTTL is set.
+// timestamp: timestamp is in ms format
+func (v *Vec) TimeSeries(timestamp int64) []*prompb.TimeSeries {
+	v.expire()
+	samples := v.samples()
+	stale := v.drainStale()
+	if len(samples)+len(stale) == 0 {
+		return nil
+	}
+
+	lastPush := v.lastPush.Swap(timestamp)
+	tsList := make([]*prompb.TimeSeries, 0, len(samples)+len(stale))
+	for _, smp := range samples {
+		tsList = append(tsList, &prompb.TimeSeries{
+			Labels:  prompbLabels(v.name, v.labels, smp.lvs, v.cfg.ConstLabels),
+			Samples: pushSamples(v.cfg, smp.value, smp.created, lastPush, timestamp),
+		})
+		if v.cfg.CreatedSeries {
+			tsList = append(tsList, createdTimeSeries(v.name, v.labels, smp.lvs, v.cfg.ConstLabels, smp.created, timestamp))
+		}
+	}
+	for _, lvs := range stale {
+		tsList = append(tsList, staleTimeSeries(v.name, v.labels, lvs, v.cfg.ConstLabels, timestamp))
+		if v.cfg.CreatedSeries {
+			tsList = append(tsList, staleTimeSeries(createdName(v.name), v.labels, lvs, v.cfg.ConstLabels, timestamp))
+		}
+	}
+	return tsList
+}
+
+// Created returns the creation time of the label values, false if the label values not exist
+func (v *Vec) Created(lvs []string) (time.Time, bool) {
+	v.mtx.RLock()
+	defer v.mtx.RUnlock()
+
+	s := v.lookup(hashLabelValues(lvs), lvs)
+	if s == nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, s.created), true
+}
+
+// Delete deletes the label values, return whether the label values existed
+func (v *Vec) Delete(lvs []string) bool {
+	return v.delete(lvs, v.cfg.StaleMarkers)
+}
+
+// DeletePartialMatch deletes all label values matching the given labels, return the number of deleted label values
+func (v *Vec) DeletePartialMatch(labels prometheus.Labels) int {
+	return v.deletePartialMatch(labels, v.cfg.StaleMarkers)
+}
+
+// Reset deletes all label values
+func (v *Vec) Reset() {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+
+	for _, s := range slices.Clone(v.series) {
+		v.deleteSeries(s, v.cfg.StaleMarkers)
+	}
+}
+
+// expire deletes the label values not updated within TTL, with staleness markers
+func (v *Vec) expire() {
+	if v.cfg.TTL <= 0 {
+		return
+	}
+	deadline := v.cfg.now().Add(-v.cfg.TTL).UnixNano()
+
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+
+	for _, s := range slices.Clone(v.series) {
+		if s.updated.Load() < deadline {
+			v.deleteSeries(s, true)
+		}
+	}
+}
+
+func (v *Vec) delete(lvs []string, stale bool) bool {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+
+	s := v.lookup(hashLabelValues(lvs), lvs)
+	if s == nil {
+		return false
+	}
+	v.deleteSeries(s, stale)
+	return true
+}
+
+func (v *Vec) deletePartialMatch(labels prometheus.Labels, stale bool) int {
+	idx := make(map[int]string, len(labels)) // index of label -> label value
+	for name, value := range labels {
+		i := slices.Index(v.labels, name)
+		if i < 0 {
+			return 0
+		}
+		idx[i] = value
+	}
+
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+
+	var deleted []*series
+	for _, s := range v.series {
+		matched := true
+		for i, value := range idx {
+			if s.lvs[i] != value {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			deleted = append(deleted, s)
+		}
+	}
+	for _, s := range deleted {
+		v.deleteSeries(s, stale)
+	}
+	return len(deleted)
+}
+
+// deleteSeries deletes s from Vec and the underlying IVec, must be called with v.mtx held
+// stale: whether to generate a staleness marker on the next TimeSeries call
+func (v *Vec) deleteSeries(s *series, stale bool) {
+	h := hashLabelValues(s.lvs)
+	v.index[h] = slices.DeleteFunc(v.index[h], func(x *series) bool { return x == s })
+	if len(v.index[h]) == 0 {
+		delete(v.index, h)
+	}
+	v.series = slices.DeleteFunc(v.series, func(x *series) bool { return x == s })
+
+	if d, ok := v.vec.(interface{ DeleteLabelValues(lvs ...string) bool }); ok {
+		d.DeleteLabelValues(s.lvs...)
+	}
+	if stale {
+		v.stale = append(v.stale, s.lvs)
+	}
+}
+
+// drainStale returns and clears the deleted label values waiting for staleness markers
+func (v *Vec) drainStale() [][]string {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+
+	stale := v.stale
+	v.stale = nil
+	return stale
+}
+
+// FNV-1a 64-bit parameters
+const (
+	offset64 = 14695981039346656037
+	prime64  = 1099511628211
+)
+
+// hashLabelValues returns the FNV-1a hash of the label values,
+// a separator byte is added after each label value, same as client_golang
+func hashLabelValues(lvs []string) uint64 {
+	var h uint64 = offset64
+	for _, lv := range lvs {
+		for i := 0; i < len(lv); i++ {
+			h ^= uint64(lv[i])
+			h *= prime64
+		}
+		h ^= uint64(model.SeparatorByte)
+		h *= prime64
+	}
+	return h
+}
+
+// Describe implements prometheus.Collector if the underlying IVec is a prometheus.Collector
+func (v *Vec) Describe(ch chan<- *prometheus.Desc) {
+	if c, ok := v.vec.(prometheus.Collector); ok {
+		c.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector if the underlying IVec is a prometheus.Collector
+func (v *Vec) Collect(ch chan<- prometheus.Metric) {
+	if c, ok := v.vec.(prometheus.Collector); ok {
+		c.Collect(ch)
+	}
+}
+
 // gaugeVec is a wrapper for prometheus.GaugeVec
 // gaugeVec implement IVec interface
 type gaugeVec struct {
 	gv *prometheus.GaugeVec
 }
 
+func newGaugeVec(name, help string, labels []string, constLabels prometheus.Labels) *gaugeVec {
+	return &gaugeVec{
+		gv: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name:        name,
+				Help:        help,
+				ConstLabels: constLabels,
+			},
+			labels,
+		),
+	}
+}
+
 func (mt *gaugeVec) GetMetricWithLabelValues(lvs ...string) (prometheus.Metric, error) {
 	m, err := mt.gv.GetMetricWithLabelValues(lvs...)
-	return m.(prometheus.Metric), err
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (mt *gaugeVec) DeleteLabelValues(lvs ...string) bool {
+	return mt.gv.DeleteLabelValues(lvs...)
+}
+
+func (mt *gaugeVec) Describe(ch chan<- *prometheus.Desc) {
+	mt.gv.Describe(ch)
+}
+
+func (mt *gaugeVec) Collect(ch chan<- prometheus.Metric) {
+	mt.gv.Collect(ch)
 }
 
 type counterVec struct {
 	cv *prometheus.CounterVec
 }
 
+func newCounterVec(name, help string, labels []string, constLabels prometheus.Labels) *counterVec {
+	return &counterVec{
+		cv: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        name,
+				Help:        help,
+				ConstLabels: constLabels,
+			},
+			labels,
+		),
+	}
+}
+
 func (mt *counterVec) GetMetricWithLabelValues(lvs ...string) (prometheus.Metric, error) {
 	m, err := mt.cv.GetMetricWithLabelValues(lvs...)
-	return m.(prometheus.Metric), err
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (mt *counterVec) DeleteLabelValues(lvs ...string) bool {
+	return mt.cv.DeleteLabelValues(lvs...)
+}
+
+func (mt *counterVec) Describe(ch chan<- *prometheus.Desc) {
+	mt.cv.Describe(ch)
+}
+
+func (mt *counterVec) Collect(ch chan<- prometheus.Metric) {
+	mt.cv.Collect(ch)
 }
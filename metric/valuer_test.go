@@ -0,0 +1,135 @@
+package metric
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestVec_Concurrent(t *testing.T) {
+	const (
+		goroutines = 8
+		lvsNum     = 100
+		loops      = 10
+	)
+	c := NewPBCounter("test_total", "test", []string{"label1", "label2"})
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < loops; i++ {
+				for j := 0; j < lvsNum; j++ {
+					c.Inc([]string{"value1", strconv.Itoa(j)})
+				}
+				c.TimeSeries(1722838400634)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := len(c.vec.LabelValues()); got != lvsNum {
+		t.Errorf("len(Vec.LabelValues()) = %d, want %d", got, lvsNum)
+	}
+	for j := 0; j < lvsNum; j++ {
+		got, err := c.GetValue([]string{"value1", strconv.Itoa(j)})
+		if err != nil {
+			t.Fatalf("PBCounter.GetValue() error = %v", err)
+		}
+		if got != goroutines*loops {
+			t.Errorf("PBCounter.GetValue() = %v, want %v", got, goroutines*loops)
+		}
+	}
+}
+
+func TestVec_GetMetricWithLabelValues(t *testing.T) {
+	v := NewVec("test_total", []string{"label1"}, newCounterVec("test_total", "test", []string{"label1"}, nil))
+	if m, err := v.GetMetricWithLabelValues("a", "b"); err == nil || m != nil {
+		t.Errorf("Vec.GetMetricWithLabelValues() = %v, %v, want an error", m, err)
+	}
+}
+
+func TestVec_LabelValues(t *testing.T) {
+	v := NewVec("test_total", []string{"label1"}, newCounterVec("test_total", "test", []string{"label1"}, nil))
+	lvs := []string{"value1"}
+	v.Inc(lvs)
+	v.Inc([]string{"value2"})
+	v.Add([]string{"value1"}, 2)
+	lvs[0] = "modified"
+
+	want := [][]string{{"value1"}, {"value2"}}
+	if got := v.LabelValues(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Vec.LabelValues() = %v, want %v", got, want)
+	}
+}
+
+func BenchmarkVec_Inc(b *testing.B) {
+	for _, n := range []int{10, 1000, 10000} {
+		v := NewVec("test_total", []string{"label1"}, newCounterVec("test_total", "test", []string{"label1"}, nil))
+		lvsList := make([][]string, n)
+		for i := range lvsList {
+			lvsList[i] = []string{strconv.Itoa(i)}
+			v.Inc(lvsList[i])
+		}
+
+		b.Run(fmt.Sprintf("series=%d", n), func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					v.Inc(lvsList[i%n])
+					i++
+				}
+			})
+		})
+	}
+}
+
+// linearScanVec is the Inc path of Vec before the label-hash index, made safe for concurrent use with a mutex,
+// used as the baseline of BenchmarkVec_Inc
+type linearScanVec struct {
+	mtx         sync.Mutex
+	labelvalues [][]string
+	vec         *counterVec
+}
+
+func (v *linearScanVec) Inc(labelvalues []string) {
+	v.vec.cv.WithLabelValues(labelvalues...).Inc()
+
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	var exist bool
+	for _, lv := range v.labelvalues {
+		if reflect.DeepEqual(lv, labelvalues) {
+			exist = true
+			break
+		}
+	}
+	if !exist {
+		v.labelvalues = append(v.labelvalues, labelvalues)
+	}
+}
+
+// BenchmarkLinearScan runs BenchmarkVec_Inc against linearScanVec
+func BenchmarkLinearScan(b *testing.B) {
+	for _, n := range []int{10, 1000, 10000} {
+		v := &linearScanVec{vec: newCounterVec("test_total", "test", []string{"label1"}, nil)}
+		lvsList := make([][]string, n)
+		for i := range lvsList {
+			lvsList[i] = []string{strconv.Itoa(i)}
+			v.Inc(lvsList[i])
+		}
+
+		b.Run(fmt.Sprintf("series=%d", n), func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					v.Inc(lvsList[i%n])
+					i++
+				}
+			})
+		})
+	}
+}